@@ -2,9 +2,9 @@ module github.com/josharian/impl
 
 go 1.18
 
-require golang.org/x/tools v0.17.0
-
 require (
-	golang.org/x/mod v0.14.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/mod v0.14.0
+	golang.org/x/tools v0.17.0
 )
+
+require golang.org/x/sys v0.16.0 // indirect
@@ -3,29 +3,143 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
 	"go/build"
+	"go/build/constraint"
 	"go/format"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/josharian/impl/methods"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/buildutil"
 	"golang.org/x/tools/imports"
 )
 
 var (
-	flagSrcDir   = flag.String("dir", "", "package source directory, useful for vendored code")
-	flagComments = flag.Bool("comments", true, "include interface comments in the generated stubs")
-	flagRecvPkg  = flag.String("recvpkg", "", "package name of the receiver")
+	flagReturns = returnsFlag{}
+	flagAliases = aliasesFlag{}
 )
 
+func init() {
+	flag.Var(flagReturns, "return", "with -body=zero or errreturn, return `type=expr` for results of the given type; may be repeated")
+	flag.Var(flagAliases, "alias", "qualify types from the package with this import path by the alias the receiver's file imports it as, given as `path=alias`; may be repeated")
+}
+
+var (
+	flagSrcDir          = flag.String("dir", "", "package source directory, useful for vendored code")
+	flagComments        = flag.Bool("comments", true, "include interface comments in the generated stubs")
+	flagRecvPkg         = flag.String("recvpkg", "", "package name of the receiver, for a receiver type not yet declared in -dir")
+	flagDocWrap         = flag.Int("doc-wrap", 0, "reflow preserved // comments to this many columns (0 disables)")
+	flagDelegate        = flag.String("delegate", "", "generate methods that forward to this field of the receiver; an unnamed receiver is named after its type")
+	flagCommentPrefix   = flag.String("comment-prefix", "", "prepend this marker to the doc comment of each generated method")
+	flagBody            = flag.String("body", panicMode, "how to write method bodies: panic, zero to return zero values, or errreturn to also return a not-implemented error")
+	flagCtxFirst        = flag.Bool("ctx-first", false, "move context.Context params first; the stubs will no longer satisfy the interface")
+	flagNoFormat        = flag.Bool("no-format", false, "print the generated code without formatting it, for when formatting fails")
+	flagHeader          = flag.Bool("header", false, "prepend a \"Code generated ... DO NOT EDIT.\" comment recording the impl command")
+	flagIfaceAt         = flag.String("iface-at", "", "use the interface declared or named at `file:line:col` instead of the <iface> argument")
+	flagStrict          = flag.Bool("strict", false, "fail if the receiver already has a method with the name of an interface method but a different signature")
+	flagExcludeComments = flag.String("exclude-comments", "", "drop preserved method comments matching this `regexp`, such as boilerplate or Deprecated notices")
+	flagIfacePkg        = flag.String("ifacepkg", "", "package name used to qualify types from the interface's package, such as an import alias")
+	flagTests           = flag.Bool("tests", false, "also look for the interface and receiver in _test.go files")
+	flagNameParams      = flag.Bool("name-params", false, "name unnamed params and results after their types, such as s for string, instead of _")
+	flagCheck           = flag.Bool("check", false, "print the signatures of unimplemented methods, one per line, instead of stubs, and exit 1 if there are any")
+	flagSigOnly         = flag.Bool("sig-only", false, "print the interface's method signatures, one per line, instead of stubs; recv only determines how types are qualified")
+	flagSpaces          = flag.Int("spaces", 0, "indent the output with this many spaces per tab instead of tabs (0 keeps tabs)")
+	flagSkipUnexported  = flag.Bool("skip-unexported", false, "omit unexported methods of interfaces from other packages instead of failing")
+	flagColEncoding     = flag.String("col-encoding", byteCols, "what the column of -iface-at counts: byte, rune, or utf16")
+	flagWrap            = flag.String("wrap", "", "like -delegate, but also pass each call's method name, args and results to the receiver's record(method string, args, results []interface{}) method")
+	flagPrefix          = flag.String("prefix", "", "prepend this to the name of each generated method, as for adapters; the renamed methods do not satisfy the interface")
+	flagCtxCheck        = flag.Bool("ctx-check", false, "make methods that accept a context.Context and return an error check it for cancellation before panicking, and other such methods assign it to _")
+	flagInferRecvParams = flag.Bool("infer-recv-params", false, "give an unparameterized generic receiver the type arguments of the interface, as in 'r *Repo' Store[T]")
+	flagOutPkg          = flag.String("outpkg", "", "package name of the generated code, if not the receiver's; its types are left unqualified and all others qualified")
+	flagTest            = flag.Bool("test", false, "print a table-driven test skeleton for each method instead of stubs")
+	flagMaxLine         = flag.Int("max-line", 0, "wrap method signatures longer than this, one param per line (0 never wraps)")
+	flagBlankUnused     = flag.Bool("blank-unused", false, "assign params to _ in methods that panic, to satisfy linters that report unused params")
+	flagFromType        = flag.Bool("from-type", false, "allow the interface argument to name a concrete type, and implement its exported methods")
+	flagUseConstructors = flag.Bool("use-constructors", false, "with -body=zero or errreturn, return the result of the receiver package's New... constructors, such as NewT() *T, for the types they construct")
+	flagVerbose         = flag.Bool("v", false, "log how the interface and its methods are resolved to stderr")
+	flagBuildTag        = flag.String("build-tag", "", "begin the output with a //go:build line for this build constraint, such as linux or 'linux && amd64'")
+	flagScaffold        = flag.Bool("scaffold", false, "also declare the receiver's type, as an empty struct, and a New constructor, unless the type already exists")
+	flagModified        = flag.Bool("modified", false, "read unsaved files from stdin, as an archive of file names, sizes and contents (the format of golang.org/x/tools/go/buildutil)")
+	flagGoimports       = flag.Bool("goimports", false, "run the stubs through goimports, preceding them with the imports they need")
+	flagKeepGoing       = flag.Bool("keep-going", false, "with several interfaces, generate stubs for those that resolve, then report those that don't and exit 1")
+	flagResultNames     = flag.String("result-names", keepResults, "how to name results: keep the interface's names, none, or auto to name them after their types")
+	flagEmbedIface      = flag.String("embed-iface", "", "declare the receiver's type as a struct embedding the interface, and generate stubs only for these comma-separated `methods`, which it overrides")
+	flagPkgName         = flag.String("pkgname", "", "the package to use from a directory that contains several, such as one with a package main beside a library")
+	flagRegion          = flag.Bool("region", false, "wrap the stubs in "+regionBegin+" and "+regionEnd+" lines, so that tools can find and replace them")
+	flagNolint          = flag.String("nolint", "", "mark each generated method with a //nolint directive for these comma-separated `linters`, such as revive,unused")
+	flagNew             = flag.String("new", "", "write the stubs for each receiver, with a package clause and imports, to a new file named after it, such as my_type.go, in `dir`")
+	flagResultStruct    = flag.Int("result-struct", 0, "wrap the results of methods with at least this many results in a struct type declared for each; the stubs will no longer satisfy the interface (0 disables)")
+	flagDryRun          = flag.Bool("dry-run", false, "with -new, print each file that would be written, under a line naming it, instead of writing it")
+	flagRewriteComments = flag.Bool("rewrite-comments", false, "begin each copied // doc comment with its method's name, as Go doc comments do, such as \"Get returns\" for \"Returns\"")
+	flagFirstMatch      = flag.Bool("first-match", false, "if an unqualified interface name is declared by several packages that -dir's package imports, use the first, with a warning, instead of failing")
+	flagMod             = flag.String("mod", "", "module download mode used to resolve packages: readonly, vendor, or mod (see 'go help modules')")
+)
+
+// returnsFlag is a flag.Value that collects type=expr pairs.
+type returnsFlag map[string]string
+
+func (f returnsFlag) String() string {
+	var pairs []string
+	for typ, expr := range f {
+		pairs = append(pairs, typ+"="+expr)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f returnsFlag) Set(s string) error {
+	typ, expr, ok := strings.Cut(s, "=")
+	typ, expr = strings.TrimSpace(typ), strings.TrimSpace(expr)
+	if !ok || typ == "" || expr == "" {
+		return fmt.Errorf("want type=expr, got %q", s)
+	}
+	f[typ] = expr
+	return nil
+}
+
+// aliasesFlag is a flag.Value that collects path=alias pairs.
+type aliasesFlag map[string]string
+
+func (f aliasesFlag) String() string {
+	var pairs []string
+	for path, alias := range f {
+		pairs = append(pairs, path+"="+alias)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f aliasesFlag) Set(s string) error {
+	path, alias, ok := strings.Cut(s, "=")
+	path, alias = strings.TrimSpace(path), strings.TrimSpace(alias)
+	if !ok || path == "" || !token.IsIdentifier(alias) {
+		return fmt.Errorf("want path=alias, got %q", s)
+	}
+	f[path] = alias
+	return nil
+}
+
 // Type is a parsed type reference.
 type Type struct {
 	// Name is the type's name. For example, in "foo[Bar, Baz]", the name
@@ -67,11 +181,48 @@ func parseType(in string) (Type, error) {
 	return typeFromAST(expr)
 }
 
+// isStdlibPackage reports whether path names a package in the standard
+// library with a single path element, such as io or context.
+func isStdlibPackage(path string) bool {
+	if path == "" || strings.ContainsAny(path, "/.") {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(build.Default.GOROOT, "src", path))
+	return err == nil && fi.IsDir()
+}
+
+// declaresType reports whether the standard library package path
+// declares a top-level type named name.
+func declaresType(path, name string) bool {
+	pkg, err := build.Import(path, "", 0)
+	if err != nil {
+		return false
+	}
+	fset := token.NewFileSet()
+	for _, file := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+				for _, spec := range decl.Specs {
+					if spec.(*ast.TypeSpec).Name.Name == name {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
 // findInterface returns the import path and type of an interface.
 // For example, given "http.ResponseWriter", findInterface returns
 // "net/http", Type{Name: "ResponseWriter"}.
 // If a fully qualified interface is given, such as "net/http.ResponseWriter",
-// it simply parses the input.
+// it simply parses the input. So does a relative import path, such as
+// "./sub.Iface", which typeSpec later resolves against srcDir.
 // If an unqualified interface such as "UserDefinedInterface" is given, then
 // the interface definition is presumed to be in the package within srcDir and
 // findInterface returns "", Type{Name: "UserDefinedInterface"}.
@@ -86,9 +237,16 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 
 	srcPath := filepath.Join(srcDir, "__go_impl__.go")
 
-	if slash := strings.LastIndex(input, "/"); slash > -1 {
+	// Type arguments may themselves be qualified, as in Foo[*os.File],
+	// so only the part before them locates the interface.
+	name := input
+	if i := strings.Index(input, "["); i > -1 {
+		name = input[:i]
+	}
+
+	if slash := strings.LastIndex(name, "/"); slash > -1 {
 		// package path provided
-		dot := strings.LastIndex(input, ".")
+		dot := strings.LastIndex(name, ".")
 		// make sure iface does not end with "/" (e.g. reject net/http/)
 		if slash+1 == len(input) {
 			return "", Type{}, fmt.Errorf("interface name cannot end with a '/' character: %s", input)
@@ -98,7 +256,7 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 			return "", Type{}, fmt.Errorf("interface name cannot end with a '.' character: %s", input)
 		}
 		// make sure iface has at least one "." after "/" (e.g. reject net/http/httputil)
-		if strings.Count(input[slash:], ".") == 0 {
+		if strings.Count(name[slash:], ".") == 0 {
 			return "", Type{}, fmt.Errorf("invalid interface name: %s", input)
 		}
 		path = input[:dot]
@@ -110,7 +268,15 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 		return path, iface, nil
 	}
 
-	src := []byte("package hack\n" + "var i " + input)
+	// Fast path: a single-segment standard library package, as in
+	// io.Reader, is its own import path, so goimports isn't needed.
+	if pkg, id, ok := strings.Cut(input, "."); ok && isStdlibPackage(pkg) {
+		if iface, err := parseType(id); err == nil && declaresType(pkg, iface.Name) {
+			return pkg, iface, nil
+		}
+	}
+
+	src := []byte("package hack\n" + "var i " + name)
 	// If we couldn't determine the import path, goimports will
 	// auto fix the import path.
 	imp, err := imports.Process(srcPath, src, nil)
@@ -126,10 +292,10 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 		panic(err)
 	}
 
-	qualified := strings.Contains(input, ".")
+	qualified := strings.Contains(name, ".")
 
 	if len(f.Imports) == 0 && qualified {
-		return "", Type{}, fmt.Errorf("unrecognized interface: %s", input)
+		return "", Type{}, kindErrorf(ErrInterfaceNotFound, "unrecognized interface: %s", input)
 	}
 
 	if !qualified {
@@ -138,9 +304,7 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 		// package hack
 		//
 		// var i Reader
-		decl := f.Decls[0].(*ast.GenDecl)      // var i Reader
-		spec := decl.Specs[0].(*ast.ValueSpec) // i Reader
-		iface, err = typeFromAST(spec.Type)
+		iface, err = parseType(input)
 		return path, iface, err
 	}
 
@@ -158,9 +322,7 @@ func findInterface(input string, srcDir string) (path string, iface Type, err er
 	if err != nil {
 		panic(err)
 	}
-	decl := f.Decls[1].(*ast.GenDecl)      // var i io.Reader
-	spec := decl.Specs[0].(*ast.ValueSpec) // i io.Reader
-	iface, err = typeFromAST(spec.Type)
+	iface, err = parseType(input)
 	if err != nil {
 		return path, iface, fmt.Errorf("error parsing type from AST: %w", err)
 	}
@@ -216,39 +378,321 @@ type Pkg struct {
 	*token.FileSet
 	// recvPkg is the package name of the function receiver
 	recvPkg string
+	// name, if set, overrides Package.Name as the qualifier for
+	// the package's types, as when it is imported under an alias.
+	name string
+	// file is the file declaring the type.
+	file *ast.File
+	// dotImports maps identifiers brought into scope by dot imports
+	// in file to the packages that declare them.
+	dotImports map[string]*build.Package
+	// aliases maps the names that would qualify types from packages
+	// other than p, such as http in file's http.Request, to the
+	// aliases that qualify them instead.
+	aliases map[string]string
+	// recvDir, if set, is the directory of the package the stubs are
+	// written in. It identifies that package more reliably than its
+	// name, recvPkg, which unrelated packages may share.
+	recvDir string
+	// recvImports holds the names under which file imports the
+	// package in recvDir, whose types need no qualifier there.
+	recvImports map[string]bool
+}
+
+// isRecvPkg reports whether pkg is the package the stubs are written
+// in, identified by recvDir if known and otherwise by recvPkg.
+func (p Pkg) isRecvPkg(pkg *build.Package) bool {
+	if p.recvDir != "" {
+		return sameFile(pkg.Dir, p.recvDir)
+	}
+	return p.recvPkg == pkg.Name
 }
 
-// Spec is ast.TypeSpec with the associated comment map.
+// Spec is ast.TypeSpec with the associated type parameters.
 type Spec struct {
 	*ast.TypeSpec
-	ast.CommentMap
 	TypeParams map[string]string
 }
 
-// typeSpec locates the *ast.TypeSpec for type id in the import path.
-func typeSpec(path string, typ Type, srcDir string) (Pkg, Spec, error) {
-	var pkg *build.Package
-	var err error
+// overlay maps the absolute paths of files to contents that replace
+// theirs on disk, such as an editor's unsaved buffers (see -modified).
+// Files that exist only in the overlay are added to their directory's
+// package, regardless of build constraints.
+var overlay map[string][]byte
 
-	if path == "" {
-		pkg, err = build.ImportDir(srcDir, 0)
+// readOverlay reads an overlay from r, in the archive format of
+// golang.org/x/tools/go/buildutil.ParseOverlayArchive: for each file,
+// its name and size in bytes, each on a line, followed by its contents.
+func readOverlay(r io.Reader) (map[string][]byte, error) {
+	archive, err := buildutil.ParseOverlayArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(archive))
+	for name, src := range archive {
+		abs, err := filepath.Abs(name)
 		if err != nil {
-			return Pkg{}, Spec{}, fmt.Errorf("couldn't find package in %s: %v", srcDir, err)
+			return nil, err
+		}
+		files[abs] = src
+	}
+	return files, nil
+}
+
+// readSource returns the contents of filename, from the overlay if it
+// has them.
+func readSource(filename string) ([]byte, error) {
+	if len(overlay) > 0 {
+		if abs, err := filepath.Abs(filename); err == nil {
+			if src, ok := overlay[abs]; ok {
+				return src, nil
+			}
+		}
+	}
+	return os.ReadFile(filename)
+}
+
+// overlayFiles returns the sorted names of the Go files in the overlay
+// that are in directory dir, excluding those in skip.
+func overlayFiles(dir string, skip []string) []string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	listed := make(map[string]bool)
+	for _, name := range skip {
+		listed[name] = true
+	}
+	var names []string
+	for path := range overlay {
+		name := filepath.Base(path)
+		if filepath.Dir(path) == abs && strings.HasSuffix(name, ".go") && !listed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsedPkg is a build.Package whose files are parsed on demand.
+type parsedPkg struct {
+	pkg   *build.Package
+	fset  *token.FileSet // shared across the whole package
+	names []string       // the package's Go and cgo file names
+	files []*ast.File    // files parsed so far; nil if a file failed to parse
+}
+
+// file returns the parsed ith file of the package, or nil if it failed to parse.
+func (pp *parsedPkg) file(i int) *ast.File {
+	for len(pp.files) <= i {
+		name := filepath.Join(pp.pkg.Dir, pp.names[len(pp.files)])
+		var f *ast.File
+		if src, err := readSource(name); err == nil {
+			f, err = parser.ParseFile(pp.fset, name, src, parser.ParseComments)
+			if err != nil {
+				f = nil
+			}
+		}
+		pp.files = append(pp.files, f)
+	}
+	return pp.files[i]
+}
+
+// pkgCache caches parsed packages by import path and source directory,
+// so that resolving an interface, including the interfaces it embeds,
+// parses each package at most once. A nil *pkgCache caches nothing.
+type pkgCache struct {
+	// tests reports whether to include the package's test files,
+	// both internal and external, when looking up types.
+	tests bool
+	// pkgName, if set, selects the package in a directory
+	// that contains several, ignoring the files of the others.
+	pkgName string
+	pkgs    map[string]*parsedPkg
+	logf    logFunc
+}
+
+// load imports the package with the given import path, or the package
+// in srcDir if path is empty.
+func (c *pkgCache) load(path, srcDir string) (*parsedPkg, error) {
+	key := path + "\x00" + srcDir
+	if c != nil {
+		if pp, ok := c.pkgs[key]; ok {
+			return pp, nil
+		}
+	}
+
+	pkg, err := c.importPkg(path, srcDir)
+	if err != nil {
+		if path == "" {
+			return nil, fmt.Errorf("couldn't find package in %s: %v", srcDir, err)
+		}
+		return nil, fmt.Errorf("couldn't find package %s: %v", path, err)
+	}
+	if path != "" {
+		if err := checkInternal(path, pkg.Dir, srcDir); err != nil {
+			return nil, err
+		}
+	}
+
+	// A package loaded by import path is also cached by directory,
+	// where the interfaces embedded by its interfaces are looked up,
+	// so that those declared in its other files are found in the
+	// files already parsed.
+	dirKey := "\x00" + pkg.Dir
+	if c != nil {
+		if pp, ok := c.pkgs[dirKey]; ok {
+			c.pkgs[key] = pp
+			return pp, nil
 		}
+		c.logf.printf("loaded package %s from %s", pkg.Name, pkg.Dir)
+	}
+	pp := &parsedPkg{pkg: pkg, fset: token.NewFileSet()}
+	pp.names = append(pp.names, pkg.GoFiles...)
+	pp.names = append(pp.names, pkg.CgoFiles...)
+	if c != nil && c.tests {
+		pp.names = append(pp.names, pkg.TestGoFiles...)
+		pp.names = append(pp.names, pkg.XTestGoFiles...)
+	}
+	for _, name := range overlayFiles(pkg.Dir, pp.names) {
+		if c != nil && c.tests || !strings.HasSuffix(name, "_test.go") {
+			pp.names = append(pp.names, name)
+		}
+	}
+	if c != nil {
+		if c.pkgs == nil {
+			c.pkgs = make(map[string]*parsedPkg)
+		}
+		c.pkgs[key] = pp
+		c.pkgs[dirKey] = pp
+	}
+	return pp, nil
+}
+
+// importPkg imports the package with the given import path, or the
+// package in srcDir if path is empty. If its directory contains several
+// packages, c.pkgName selects one; without it, importPkg fails.
+func (c *pkgCache) importPkg(path, srcDir string) (*build.Package, error) {
+	ctxt := build.Default
+	var pkg *build.Package
+	var err error
+	if path == "" {
+		pkg, err = ctxt.ImportDir(srcDir, 0)
 	} else {
-		pkg, err = build.Import(path, srcDir, 0)
-		if err != nil {
-			return Pkg{}, Spec{}, fmt.Errorf("couldn't find package %s: %v", path, err)
+		// In module mode, import paths are resolved by running go
+		// list, which otherwise runs in the current directory.
+		// Running it in srcDir instead makes it find srcDir's module,
+		// by walking up to its go.mod, and that module's vendor
+		// directory. It then requires srcDir to be absolute.
+		if abs, err := filepath.Abs(srcDir); err == nil {
+			srcDir = abs
 		}
+		ctxt.Dir = srcDir
+		pkg, err = ctxt.Import(path, srcDir, 0)
 	}
+	var multi *build.MultiplePackageError
+	if !errors.As(err, &multi) {
+		return pkg, err
+	}
+	if c == nil || c.pkgName == "" {
+		return nil, fmt.Errorf("%s contains several packages, %s; use -pkgname to choose one", multi.Dir, strings.Join(uniqueStrings(multi.Packages), " and "))
+	}
+	// A custom ReadDir turns off module-aware lookup of import
+	// paths, so import the directory already found instead.
+	ctxt.ReadDir = packageFiles(c.pkgName)
+	pkg, err = ctxt.ImportDir(multi.Dir, 0)
+	if pkg != nil && path != "" {
+		pkg.ImportPath = path
+	}
+	return pkg, err
+}
 
-	fset := token.NewFileSet() // share one fset across the whole package
-	var files []string
-	files = append(files, pkg.GoFiles...)
-	files = append(files, pkg.CgoFiles...)
-	for _, file := range files {
-		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, parser.ParseComments)
+// packageFiles returns a build.Context.ReadDir that omits the Go files
+// in a directory that belong to a package other than pkgName or its
+// external test package.
+func packageFiles(pkgName string) func(dir string) ([]fs.FileInfo, error) {
+	return func(dir string) ([]fs.FileInfo, error) {
+		entries, err := os.ReadDir(dir)
 		if err != nil {
+			return nil, err
+		}
+		var infos []fs.FileInfo
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+				src, err := readSource(filepath.Join(dir, e.Name()))
+				if err != nil {
+					return nil, err
+				}
+				f, err := parser.ParseFile(token.NewFileSet(), e.Name(), src, parser.PackageClauseOnly)
+				if err == nil && f.Name.Name != pkgName && f.Name.Name != pkgName+"_test" {
+					continue
+				}
+			}
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+}
+
+// uniqueStrings returns the distinct strings in list, in order.
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// checkInternal reports an error if the package at path, found in dir,
+// is internal and srcDir is outside the tree rooted at the parent of its
+// internal directory. build.Import leaves this check to the go command.
+func checkInternal(path, dir, srcDir string) error {
+	elems := strings.Split(path, "/")
+	i := len(elems) - 1
+	for i >= 0 && elems[i] != "internal" {
+		i--
+	}
+	if i < 0 {
+		return nil
+	}
+	root := dir
+	for n := len(elems) - i; n > 0; n-- {
+		root = filepath.Dir(root)
+	}
+	if abs, err := filepath.Abs(srcDir); err == nil {
+		srcDir = abs
+	}
+	rel, err := filepath.Rel(root, srcDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("use of internal package %s not allowed from %s", path, srcDir)
+	}
+	return nil
+}
+
+// typeSpec locates the *ast.TypeSpec for type id in the import path.
+func typeSpec(path string, typ Type, srcDir string) (Pkg, Spec, error) {
+	return (*pkgCache)(nil).typeSpec(path, typ, srcDir)
+}
+
+// typeSpec is like the typeSpec function, but loads packages through c.
+func (c *pkgCache) typeSpec(path string, typ Type, srcDir string) (Pkg, Spec, error) {
+	pp, err := c.load(path, srcDir)
+	if err != nil {
+		return Pkg{}, Spec{}, err
+	}
+
+	var ifaces []string
+	for i := range pp.names {
+		f := pp.file(i)
+		if f == nil {
 			continue
 		}
 
@@ -260,21 +704,188 @@ func typeSpec(path string, typ Type, srcDir string) (Pkg, Spec, error) {
 			for _, spec := range decl.Specs {
 				spec := spec.(*ast.TypeSpec)
 				if spec.Name.Name != typ.Name {
+					if _, ok := spec.Type.(*ast.InterfaceType); ok {
+						ifaces = append(ifaces, spec.Name.Name)
+					}
 					continue
 				}
 				typeParams, ok := matchTypeParams(spec, typ.Params)
 				if !ok {
 					continue
 				}
-				p := Pkg{Package: pkg, FileSet: fset}
+				bp := pp.pkg
+				if f.Name.Name != bp.Name {
+					// f belongs to the external test package,
+					// whose name has a _test suffix.
+					xp := *bp
+					xp.Name = f.Name.Name
+					bp = &xp
+				}
+				p := Pkg{Package: bp, FileSet: pp.fset, file: f, dotImports: dotImportedNames(f, pp.pkg.Dir)}
 				s := Spec{TypeSpec: spec, TypeParams: typeParams}
 				return p, s, nil
 			}
 		}
 	}
+	if name := suggestName(typ.Name, ifaces); name != "" {
+		return Pkg{}, Spec{}, fmt.Errorf("type %s not found in %s; did you mean %s?", typ.Name, path, name)
+	}
 	return Pkg{}, Spec{}, fmt.Errorf("type %s not found in %s", typ.Name, path)
 }
 
+// suggestName returns the name in names closest to name, ignoring case,
+// or "" if none is close enough to be a likely typo: within one edit
+// for every three characters of name, rounded down.
+func suggestName(name string, names []string) string {
+	best, bestDist := "", len(name)/3+1
+	for _, n := range names {
+		d := editDistance(strings.ToLower(name), strings.ToLower(n))
+		if d < bestDist || d == bestDist && best != "" && n < best {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// importPath returns the import path of the package imported
+// by f under the given name.
+func (c *pkgCache) importPath(f *ast.File, name, srcDir string) (string, error) {
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == name {
+				return path, nil
+			}
+			continue
+		}
+		pp, err := c.load(path, srcDir)
+		if err != nil {
+			continue
+		}
+		if pp.pkg.Name == name {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no import of package %s", name)
+}
+
+// typeSpecUpward is like typeSpec for an unqualified type, but if the type
+// is not found in srcDir, it also searches the parent directories of srcDir,
+// stopping at the enclosing module root. This lets impl be run from within
+// a subdirectory of the package that declares the interface.
+func (c *pkgCache) typeSpecUpward(typ Type, srcDir string) (Pkg, Spec, error) {
+	dir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return Pkg{}, Spec{}, err
+	}
+	var firstErr error
+	for {
+		p, s, err := c.typeSpec("", typ, dir)
+		if err == nil {
+			return p, s, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return Pkg{}, Spec{}, firstErr
+}
+
+// dotImportedNames returns the exported top-level identifiers brought into
+// scope in f by dot imports (import . "path"), mapped to the package that
+// declares them. It returns nil if f has no dot imports.
+func dotImportedNames(f *ast.File, srcDir string) map[string]*build.Package {
+	var names map[string]*build.Package
+	for _, imp := range f.Imports {
+		if imp.Name == nil || imp.Name.Name != "." {
+			continue
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		pkg, err := build.Import(path, srcDir, 0)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		for _, file := range pkg.GoFiles {
+			src, err := readSource(filepath.Join(pkg.Dir, file))
+			if err != nil {
+				continue
+			}
+			f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), src, 0)
+			if err != nil {
+				continue
+			}
+			for _, decl := range f.Decls {
+				decl, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					var idents []*ast.Ident
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						idents = []*ast.Ident{spec.Name}
+					case *ast.ValueSpec:
+						idents = spec.Names
+					}
+					for _, id := range idents {
+						if !id.IsExported() {
+							continue
+						}
+						if names == nil {
+							names = make(map[string]*build.Package)
+						}
+						names[id.Name] = pkg
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
 // matchTypeParams returns a map of type parameters from a parsed interface
 // definition and the types that fill them from the user's specified type
 // info. If the passed params can't be used to fill the type parameters on the
@@ -317,37 +928,106 @@ func (p Pkg) gofmt(e ast.Expr) string {
 //	fullType(Handler) => "http.Handler"
 //	fullType(io.Reader) => "io.Reader"
 //	fullType(*Request) => "*http.Request"
-func (p Pkg) fullType(e ast.Expr) string {
-	ast.Inspect(e, func(n ast.Node) bool {
+//
+// Types are left unqualified if they belong to the package the
+// stubs are written in, p.recvPkg, whether declared in p or referred
+// to from another package, as in io.Reader when writing to package io.
+// Types referred to from another package are only recognized as such
+// if p.recvDir locates the package.
+//
+// Identifiers brought into scope by a dot import are qualified
+// with the name of the package that declares them.
+//
+// Packages with an alias in p.aliases are qualified by it instead.
+//
+// Type parameters named in typeParams are replaced by their
+// corresponding types wherever they appear in e, including
+// within composite types such as func(T) error.
+func (p Pkg) fullType(e ast.Expr, typeParams map[string]string) (string, error) {
+	if ell, ok := e.(*ast.Ellipsis); ok {
+		elt, err := p.fullType(ell.Elt, typeParams)
+		return "..." + elt, err
+	}
+	// The parsed AST may be shared by later lookups of the same package,
+	// so rewrite identifiers in a fresh copy of e rather than in place.
+	fset := token.NewFileSet()
+	src := p.gofmt(e)
+	e, err := parser.ParseExprFrom(fset, "", src, 0)
+	if err != nil {
+		return "", fmt.Errorf("invalid type %s: %v", src, err)
+	}
+	var qualify func(n ast.Node) bool
+	qualify = func(n ast.Node) bool {
 		switch n := n.(type) {
+		case *ast.Field:
+			// The names of params, results, struct fields and
+			// methods within e are local; only their types refer
+			// to other types.
+			ast.Inspect(n.Type, qualify)
+			return false
 		case *ast.Ident:
+			if typ, ok := typeParams[n.Name]; ok {
+				n.Name = typ
+				break
+			}
 			// Using typeSpec instead of IsExported here would be
 			// more accurate, but it'd be crazy expensive, and if
 			// the type isn't exported, there's no point trying
 			// to implement it anyway.
-			if n.IsExported() && p.recvPkg != p.Package.Name {
+			if !n.IsExported() {
+				break
+			}
+			if pkg, ok := p.dotImports[n.Name]; ok {
+				if alias, ok := p.aliases[pkg.Name]; ok {
+					n.Name = alias + "." + n.Name
+				} else if !p.isRecvPkg(pkg) {
+					n.Name = pkg.Name + "." + n.Name
+				}
+				break
+			}
+			if p.name != "" {
+				n.Name = p.name + "." + n.Name
+			} else if !p.isRecvPkg(p.Package) {
 				n.Name = p.Package.Name + "." + n.Name
 			}
 		case *ast.SelectorExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				if alias, ok := p.aliases[id.Name]; ok {
+					id.Name = alias
+				}
+			}
 			return false
 		}
 		return true
-	})
-	return p.gofmt(e)
+	}
+	ast.Inspect(e, qualify)
+	if len(p.recvImports) > 0 {
+		// Types from the receiver's package need no qualifier there.
+		// Packages are matched by where their imports resolve to,
+		// not by name, which unrelated packages may share.
+		e = astutil.Apply(e, func(c *astutil.Cursor) bool {
+			sel, ok := c.Node().(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := sel.X.(*ast.Ident); ok && p.recvImports[id.Name] {
+				c.Replace(sel.Sel)
+			}
+			return false
+		}, nil).(ast.Expr)
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
-func (p Pkg) params(field *ast.Field, typeParams map[string]string) []Param {
+func (p Pkg) params(field *ast.Field, typeParams map[string]string) ([]Param, error) {
 	var params []Param
-	var typ string
-	switch expr := field.Type.(type) {
-	case *ast.Ident:
-		if genType, ok := typeParams[expr.Name]; ok {
-			typ = genType
-		} else {
-			typ = p.fullType(field.Type)
-		}
-	default:
-		typ = p.fullType(field.Type)
+	typ, err := p.fullType(field.Type, typeParams)
+	if err != nil {
+		return nil, err
 	}
 	for _, name := range field.Names {
 		params = append(params, Param{Name: name.Name, Type: typ})
@@ -356,28 +1036,24 @@ func (p Pkg) params(field *ast.Field, typeParams map[string]string) []Param {
 	if len(params) == 0 {
 		params = []Param{{Type: typ}}
 	}
-	return params
+	return params, nil
 }
 
 // Method represents a method signature.
 type Method struct {
 	Recv string
 	Func
+	// Body is the method body, without the enclosing braces.
+	Body string
+	// Wrap puts each param on its own line.
+	Wrap bool
 }
 
 // Func represents a function signature.
-type Func struct {
-	Name     string
-	Params   []Param
-	Res      []Param
-	Comments string
-}
+type Func = methods.Func
 
 // Param represents a parameter in a function or method signature.
-type Param struct {
-	Name string
-	Type string
-}
+type Param = methods.Param
 
 // EmitComments specifies whether comments from the interface should be preserved in the implementation.
 type EmitComments bool
@@ -387,12 +1063,24 @@ const (
 	WithoutComments EmitComments = false
 )
 
-func (p Pkg) funcsig(f *ast.Field, typeParams map[string]string, cmap ast.CommentMap, comments EmitComments) Func {
+func (p Pkg) funcsig(f *ast.Field, typeParams map[string]string, comments EmitComments, docWrap int, exclude *regexp.Regexp) (Func, error) {
 	fn := Func{Name: f.Names[0].Name}
-	typ := f.Type.(*ast.FuncType)
+	typ, ok := f.Type.(*ast.FuncType)
+	if !ok {
+		return Func{}, fmt.Errorf("%s is not a method", fn.Name)
+	}
+	if typ.TypeParams != nil && len(typ.TypeParams.List) > 0 {
+		// Go does not (yet) permit methods to declare their own
+		// type parameters, so there is no valid stub to generate.
+		return Func{}, fmt.Errorf("method %s has type parameters, which are not supported", fn.Name)
+	}
 	if typ.Params != nil {
 		for _, field := range typ.Params.List {
-			for _, param := range p.params(field, typeParams) {
+			params, err := p.params(field, typeParams)
+			if err != nil {
+				return Func{}, fmt.Errorf("method %s: %v", fn.Name, err)
+			}
+			for _, param := range params {
 				// only for method parameters:
 				// assign a blank identifier "_" to an anonymous parameter
 				if param.Name == "" {
@@ -404,13 +1092,44 @@ func (p Pkg) funcsig(f *ast.Field, typeParams map[string]string, cmap ast.Commen
 	}
 	if typ.Results != nil {
 		for _, field := range typ.Results.List {
-			fn.Res = append(fn.Res, p.params(field, typeParams)...)
+			res, err := p.params(field, typeParams)
+			if err != nil {
+				return Func{}, fmt.Errorf("method %s: %v", fn.Name, err)
+			}
+			fn.Res = append(fn.Res, res...)
 		}
 	}
 	if comments == WithComments && f.Doc != nil {
-		fn.Comments = flattenDocComment(f)
+		fn.Comments = flattenDocComment(f, docWrap)
+		if exclude != nil && exclude.MatchString(fn.Comments) {
+			fn.Comments = ""
+		}
 	}
-	return fn
+	return fn, nil
+}
+
+// Kinds of errors returned while locating an interface.
+// Use errors.Is to tell them apart.
+var (
+	ErrInterfaceNotFound  = errors.New("interface not found")
+	ErrNotAnInterface     = errors.New("not an interface")
+	ErrEmptyInterface     = errors.New("empty interface")
+	ErrAmbiguousInterface = errors.New("ambiguous interface")
+)
+
+// kindError is an error of one of the kinds above,
+// with a message describing the specific failure.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+func (e *kindError) Unwrap() error { return e.kind }
+
+// kindErrorf returns an error of the given kind with a formatted message.
+func kindErrorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
 }
 
 // The error interface is built-in.
@@ -419,199 +1138,2985 @@ var errorInterface = []Func{{
 	Res:  []Param{{Type: "string"}},
 }}
 
-// funcs returns the set of methods required to implement iface.
-// It is called funcs rather than methods because the
-// function descriptions are functions; there is no receiver.
-func funcs(iface, srcDir, recvPkg string, comments EmitComments) ([]Func, error) {
-	// Special case for the built-in error interface.
-	if iface == "error" {
-		return errorInterface, nil
-	}
+// builtinInterfaces maps the predeclared interfaces, which have no
+// source to parse, to their methods. comparable is only a constraint,
+// so it can be embedded in other constraints but not implemented.
+var builtinInterfaces = map[string][]Func{
+	"error":      errorInterface,
+	"any":        nil,
+	"comparable": nil,
+}
 
-	// Locate the interface.
-	path, typ, err := findInterface(iface, srcDir)
-	if err != nil {
-		return nil, err
-	}
+// logFunc logs a message describing a resolution step. A nil logFunc
+// logs nothing.
+type logFunc func(format string, args ...interface{})
 
-	// Parse the package and find the interface declaration.
-	p, spec, err := typeSpec(path, typ, srcDir)
-	if err != nil {
-		return nil, fmt.Errorf("interface %s not found: %s", iface, err)
+func (f logFunc) printf(format string, args ...interface{}) {
+	if f != nil {
+		f(format, args...)
 	}
-	p.recvPkg = recvPkg
+}
 
-	idecl, ok := spec.Type.(*ast.InterfaceType)
+// resolver locates interfaces and computes the methods required to implement them.
+type resolver struct {
+	srcDir   string
+	recvPkg  string
+	comments EmitComments
+	// tests reports whether to look for types in test files, too.
+	tests bool
+	// ifacePkg, if set, is the name used to qualify types from the
+	// interface's own package, overriding its declared package name.
+	ifacePkg string
+	// docWrap is the column at which preserved //-style comments
+	// are reflowed. Zero disables reflowing.
+	docWrap int
+	// excludeComments, if non-nil, drops preserved comments that it matches.
+	excludeComments *regexp.Regexp
+	// colEncoding is the encoding of the columns of positions
+	// given to funcsAt: byteCols (the default), runeCols or utf16Cols.
+	colEncoding string
+	// skipUnexported omits unexported methods of interfaces from other
+	// packages, which the receiver cannot implement, instead of failing.
+	skipUnexported bool
+	// fromType allows the interface to name a concrete type instead,
+	// whose exported methods are then the ones to implement.
+	fromType bool
+	// logf logs each resolution step, for -v.
+	logf logFunc
+	// warnf reports problems that don't stop resolution.
+	warnf logFunc
+	// firstMatch resolves an unqualified interface name declared by
+	// several of the packages that srcDir's package imports to the
+	// first of them, with a warning, instead of failing.
+	firstMatch bool
+	// pkgName, if set, selects the package to use from directories
+	// that contain several.
+	pkgName string
+	// aliases maps import paths to the aliases under which the
+	// receiver's file imports them, which qualify their types
+	// instead of their package names.
+	aliases map[string]string
+
+	// pkgs and ifaces cache parsed packages and located interfaces,
+	// which are often revisited while resolving embedded interfaces.
+	pkgs   *pkgCache
+	ifaces map[string]foundInterface
+}
+
+// foundInterface is the result of findInterface.
+type foundInterface struct {
+	path string
+	typ  Type
+}
+
+// findInterface is like the findInterface function, but caches its results.
+func (r *resolver) findInterface(iface string) (string, Type, error) {
+	if found, ok := r.ifaces[iface]; ok {
+		return found.path, found.typ, nil
+	}
+	path, typ, err := findInterface(iface, r.srcDir)
+	if err != nil {
+		return "", Type{}, err
+	}
+	if path == "" {
+		if path, err = r.importedInterface(typ); err != nil {
+			return "", Type{}, err
+		}
+	}
+	if r.ifaces == nil {
+		r.ifaces = make(map[string]foundInterface)
+	}
+	r.ifaces[iface] = foundInterface{path: path, typ: typ}
+	if path == "" {
+		r.logf.printf("resolved %s to %s in %s", iface, typ, r.srcDir)
+	} else {
+		r.logf.printf("resolved %s to %s in %s", iface, typ, path)
+	}
+	return path, typ, nil
+}
+
+// importedInterface returns the import path of the package that
+// declares the unqualified interface typ when srcDir's package does
+// not, but one of the packages it imports does, or "" if none do.
+// If several do, it fails, listing them so that typ can be qualified,
+// unless r.firstMatch is set, in which case it warns and returns the
+// first in import order.
+func (r *resolver) importedInterface(typ Type) (string, error) {
+	if r.pkgs == nil {
+		r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+	}
+	if _, _, err := r.pkgs.typeSpecUpward(typ, r.srcDir); err == nil {
+		return "", nil
+	}
+	pp, err := r.pkgs.load("", r.srcDir)
+	if err != nil {
+		return "", nil
+	}
+	var candidates []string
+	seen := make(map[string]bool)
+	for i := range pp.names {
+		f := pp.file(i)
+		if f == nil {
+			continue
+		}
+		for _, imp := range f.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || seen[path] || path == "C" {
+				continue
+			}
+			seen[path] = true
+			_, spec, err := r.pkgs.typeSpec(path, typ, r.srcDir)
+			if err != nil {
+				continue
+			}
+			if _, ok := spec.Type.(*ast.InterfaceType); ok || r.fromType {
+				candidates = append(candidates, path)
+			}
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return "", nil
+	case len(candidates) == 1:
+		r.logf.printf("found %s in imported package %s", typ.Name, candidates[0])
+		return candidates[0], nil
+	case r.firstMatch:
+		r.warnf.printf("%s is declared by several imported packages, %s; using %s", typ.Name, strings.Join(candidates, ", "), candidates[0])
+		return candidates[0], nil
+	}
+	return "", kindErrorf(ErrAmbiguousInterface, "%s is ambiguous: it is declared by the imported packages %s; qualify it, as in %s.%s, or use -first-match", typ.Name, strings.Join(candidates, ", "), candidates[0], typ.Name)
+}
+
+// funcs returns the set of methods required to implement iface,
+// using the default resolver options.
+func funcs(iface, srcDir, recvPkg string, comments EmitComments) ([]Func, error) {
+	r := &resolver{srcDir: srcDir, recvPkg: recvPkg, comments: comments}
+	return r.funcs(iface)
+}
+
+// funcs returns the set of methods required to implement iface.
+// It is called funcs rather than methods because the
+// function descriptions are functions; there is no receiver.
+func (r *resolver) funcs(iface string) ([]Func, error) {
+	// Special case for the predeclared interfaces.
+	if fns, ok := builtinInterfaces[iface]; ok {
+		if iface == "comparable" {
+			return nil, kindErrorf(ErrNotAnInterface, "%s is a constraint and cannot be implemented", iface)
+		}
+		if len(fns) == 0 {
+			return nil, kindErrorf(ErrEmptyInterface, "%s has no methods: every type implements it", iface)
+		}
+		return fns, nil
+	}
+
+	if e, err := parser.ParseExpr(iface); err == nil {
+		if _, ok := e.(*ast.InterfaceType); ok {
+			return r.literalFuncs(iface)
+		}
+	} else if strings.HasPrefix(iface, "interface") && strings.HasPrefix(strings.TrimSpace(iface[len("interface"):]), "{") {
+		// A malformed literal: let literalFuncs report why.
+		return r.literalFuncs(iface)
+	}
+
+	// An @version suffix selects the interface's module version.
+	iface, version, versioned := strings.Cut(iface, "@")
+
+	// Locate the interface.
+	path, typ, err := r.findInterface(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the package and find the interface declaration.
+	if r.pkgs == nil {
+		r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+	}
+	var p Pkg
+	var spec Spec
+	switch {
+	case versioned:
+		if path == "" {
+			return nil, fmt.Errorf("interface %s@%s: a version requires a full import path", iface, version)
+		}
+		dir, err := moduleDir(path, version)
+		if err != nil {
+			return nil, err
+		}
+		p, spec, err = r.pkgs.typeSpec("", typ, dir)
+	case path == "":
+		p, spec, err = r.pkgs.typeSpecUpward(typ, r.srcDir)
+	default:
+		p, spec, err = r.pkgs.typeSpec(path, typ, r.srcDir)
+	}
+	if err != nil {
+		return nil, kindErrorf(ErrInterfaceNotFound, "interface %s not found: %s", iface, err)
+	}
+	p.name = r.ifacePkg
+	r.logf.printf("found %s in %s", iface, p.FileSet.Position(spec.Pos()).Filename)
+	if _, ok := spec.Type.(*ast.InterfaceType); !ok && r.fromType {
+		return r.typeMethods(iface, p, spec)
+	}
+	return r.methods(iface, p, spec)
+}
+
+// literalFuncs returns the set of methods required to implement lit,
+// an interface type literal such as interface{ Close() error }.
+// The literal is resolved as if it were written in srcDir: its
+// unqualified names refer to that package, and goimports locates the
+// packages of its qualified ones.
+func (r *resolver) literalFuncs(lit string) ([]Func, error) {
+	srcPath := filepath.Join(r.srcDir, "__go_impl__.go")
+	src, err := imports.Process(srcPath, []byte("package hack\ntype _ "+lit), nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse interface %s: %v", lit, err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, srcPath, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var spec *ast.TypeSpec
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+			spec = decl.Specs[0].(*ast.TypeSpec)
+		}
+	}
+
+	if r.pkgs == nil {
+		r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+	}
+	bp := &build.Package{Dir: r.srcDir, Name: r.recvPkg}
+	if pp, err := r.pkgs.load("", r.srcDir); err == nil {
+		bp = pp.pkg
+	}
+	p := Pkg{Package: bp, FileSet: fset, file: f, dotImports: dotImportedNames(f, r.srcDir)}
+	return r.methods(lit, p, Spec{TypeSpec: spec})
+}
+
+// ifaceType returns the type expression by which the receiver's package
+// refers to iface, such as io.Reader or Store[K, V].
+func (r *resolver) ifaceType(iface string) (string, error) {
+	if _, ok := builtinInterfaces[iface]; ok {
+		return iface, nil
+	}
+	if e, err := parser.ParseExpr(iface); err == nil {
+		if _, ok := e.(*ast.InterfaceType); ok {
+			return iface, nil
+		}
+	}
+	iface, _, _ = strings.Cut(iface, "@")
+	path, typ, err := r.findInterface(iface)
+	if err != nil {
+		return "", err
+	}
+	name := typ.Name
+	if path != "" {
+		if r.pkgs == nil {
+			r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+		}
+		pp, err := r.pkgs.load(path, r.srcDir)
+		if err != nil {
+			return "", err
+		}
+		pkgName := pp.pkg.Name
+		if alias, ok := r.aliases[path]; ok {
+			pkgName = alias
+		}
+		if r.ifacePkg != "" {
+			pkgName = r.ifacePkg
+		}
+		if pkgName != r.recvPkg {
+			name = pkgName + "." + name
+		}
+	}
+	if len(typ.Params) > 0 {
+		name += "[" + strings.Join(typ.Params, ", ") + "]"
+	}
+	return name, nil
+}
+
+// funcsOf returns the set of methods required to implement all of
+// ifaces, in order. A method required by several is included once,
+// as the first requires it; if they require different signatures,
+// no type can implement them all, and funcsOf fails. If keepGoing
+// is set, the interfaces that fail to resolve are skipped, and their
+// errors reported together alongside the methods of the others;
+// otherwise the first error is returned.
+func (r *resolver) funcsOf(ifaces []string, keepGoing bool) ([]Func, error) {
+	var fns []Func
+	var failed []string
+	// seen maps the name of each method to the interface
+	// that first requires it, and its signature there.
+	type requirement struct{ iface, sig string }
+	seen := make(map[string]requirement)
+	for _, iface := range ifaces {
+		ifns, err := r.funcs(iface)
+		if err != nil {
+			if !keepGoing {
+				return nil, err
+			}
+			failed = append(failed, err.Error())
+			continue
+		}
+		for _, fn := range ifns {
+			sig := typeSignature(fn)
+			first, ok := seen[fn.Name]
+			if !ok {
+				seen[fn.Name] = requirement{iface: iface, sig: sig}
+				fns = append(fns, fn)
+				continue
+			}
+			if first.sig != sig {
+				return nil, fmt.Errorf("conflicting signatures for method %s: %s requires %s, but %s requires %s", fn.Name, first.iface, first.sig, iface, sig)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fns, fmt.Errorf("%d of %d interfaces failed to resolve:\n%s", len(failed), len(ifaces), strings.Join(failed, "\n"))
+	}
+	return fns, nil
+}
+
+// moduleDir returns the directory in the module cache that holds
+// the package with the given import path at the given module version.
+// The module path is not known, so each prefix of path is tried in turn.
+func moduleDir(path, version string) (string, error) {
+	out, err := exec.Command("go", "env", "GOMODCACHE").Output()
+	if err != nil {
+		return "", fmt.Errorf("couldn't locate the module cache: %v", err)
+	}
+	cache := strings.TrimSpace(string(out))
+	ever, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	mod, sub := path, ""
+	for {
+		if emod, err := module.EscapePath(mod); err == nil {
+			dir := filepath.Join(cache, emod+"@"+ever, filepath.FromSlash(sub))
+			if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+				return dir, nil
+			}
+		}
+		i := strings.LastIndex(mod, "/")
+		if i < 0 {
+			break
+		}
+		mod, sub = mod[:i], mod[i+1:]+"/"+sub
+	}
+	return "", fmt.Errorf("package %s@%s is not in the module cache; download it with 'go mod download <module>@%s'", path, version, version)
+}
+
+// funcsAt returns the set of methods required to implement the
+// interface whose declaration encloses pos, given as file:line:col,
+// or, outside of interface declarations, the interface named at pos.
+// Lines and columns are 1-based; columns count units of
+// r.colEncoding, as set by -col-encoding: bytes by default.
+func (r *resolver) funcsAt(pos string) ([]Func, error) {
+	filename, line, col, err := parsePosition(pos)
+	if err != nil {
+		return nil, err
+	}
+	src, err := readSource(filename)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(f.Pos())
+	if line > tf.LineCount() {
+		return nil, fmt.Errorf("invalid position %s: file has %d lines", pos, tf.LineCount())
+	}
+	start := tf.Offset(tf.LineStart(line))
+	text := src[start:]
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	n, err := columnOffset(text, col, r.colEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid position %s: %v", pos, err)
+	}
+	at := tf.Pos(start + n)
+
+	var name string
+	var ref ast.Expr // innermost type name at pos, possibly with type arguments
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil || at < n.Pos() || at > n.End() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			if _, ok := n.Type.(*ast.InterfaceType); ok {
+				if n.TypeParams != nil {
+					err = fmt.Errorf("interface %s at %s is generic; name it with its type arguments instead", n.Name.Name, pos)
+				}
+				name = n.Name.Name
+			}
+		case *ast.IndexExpr:
+			if at <= n.X.End() {
+				ref = n
+				return false
+			}
+		case *ast.IndexListExpr:
+			if at <= n.X.End() {
+				ref = n
+				return false
+			}
+		case *ast.SelectorExpr:
+			if _, ok := n.X.(*ast.Ident); ok {
+				ref = n
+			}
+			return false
+		case *ast.Ident:
+			ref = n
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.pkgs == nil {
+		r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+	}
+	dir := filepath.Dir(filename)
+	if name == "" && ref != nil {
+		// Resolve the name as if it were embedded in an interface in f.
+		pp, err := r.pkgs.load("", dir)
+		if err != nil {
+			return nil, err
+		}
+		p := Pkg{Package: pp.pkg, FileSet: fset, recvPkg: r.recvPkg, name: r.ifacePkg, file: f, dotImports: dotImportedNames(f, dir)}
+		return r.embedded("", false, p, ref, nil)
+	}
+	if name == "" {
+		return nil, kindErrorf(ErrInterfaceNotFound, "no interface declaration at %s", pos)
+	}
+
+	p, spec, err := r.pkgs.typeSpec("", Type{Name: name}, dir)
+	if err != nil {
+		return nil, kindErrorf(ErrInterfaceNotFound, "interface %s not found: %s", name, err)
+	}
+	p.name = r.ifacePkg
+	return r.methods(name, p, spec)
+}
+
+// Column encodings, which say what the columns of positions count.
+const (
+	byteCols  = "byte"
+	runeCols  = "rune"
+	utf16Cols = "utf16"
+)
+
+// columnOffset returns the byte offset within line of the 1-based
+// column col, which counts units of the given encoding: bytes (the
+// default, used when empty), runes, or UTF-16 code units, as sent
+// by editors such as VS Code.
+func columnOffset(line []byte, col int, encoding string) (int, error) {
+	if encoding == "" || encoding == byteCols {
+		if col-1 > len(line) {
+			return 0, fmt.Errorf("column %d out of range", col)
+		}
+		return col - 1, nil
+	}
+	if encoding != runeCols && encoding != utf16Cols {
+		return 0, fmt.Errorf("unknown column encoding %q", encoding)
+	}
+	off, units := 0, 0
+	for units < col-1 {
+		if off >= len(line) {
+			return 0, fmt.Errorf("column %d out of range", col)
+		}
+		r, size := utf8.DecodeRune(line[off:])
+		off += size
+		units++
+		if encoding == utf16Cols && r >= 0x10000 {
+			// Encoded as a surrogate pair.
+			units++
+		}
+	}
+	return off, nil
+}
+
+// parsePosition parses a position of the form file:line:col.
+func parsePosition(pos string) (filename string, line, col int, err error) {
+	rest, colStr, ok := cutLast(pos, ":")
+	if !ok {
+		return "", 0, 0, fmt.Errorf("invalid position %q: want file:line:col", pos)
+	}
+	filename, lineStr, ok := cutLast(rest, ":")
+	if !ok || filename == "" {
+		return "", 0, 0, fmt.Errorf("invalid position %q: want file:line:col", pos)
+	}
+	line, err = strconv.Atoi(lineStr)
+	if err != nil || line < 1 {
+		return "", 0, 0, fmt.Errorf("invalid line in position %q", pos)
+	}
+	col, err = strconv.Atoi(colStr)
+	if err != nil || col < 1 {
+		return "", 0, 0, fmt.Errorf("invalid column in position %q", pos)
+	}
+	return filename, line, col, nil
+}
+
+// cutLast is like strings.Cut, but cuts around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// typeMethods returns the exported methods declared on the concrete
+// type named iface, declared by spec in p, in source order. Methods
+// promoted from embedded fields are not included.
+func (r *resolver) typeMethods(iface string, p Pkg, spec Spec) ([]Func, error) {
+	pp, err := r.pkgs.load("", p.Package.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var fns []Func
+	for i := range pp.names {
+		f := pp.file(i)
+		if f == nil || f.Name.Name != p.Package.Name {
+			continue
+		}
+		fp := r.withAliases(r.withRecvPkg(Pkg{Package: pp.pkg, FileSet: pp.fset, name: p.name, file: f, dotImports: dotImportedNames(f, pp.pkg.Dir)}))
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Recv == nil || len(decl.Recv.List) == 0 || !decl.Name.IsExported() {
+				continue
+			}
+			name, params := receiverTypeName(decl.Recv.List[0].Type)
+			if name != spec.Name.Name {
+				continue
+			}
+			// The receiver may name the type's parameters differently
+			// from its declaration.
+			typeParams := make(map[string]string)
+			var declared []*ast.Ident
+			if spec.TypeSpec.TypeParams != nil {
+				for _, field := range spec.TypeSpec.TypeParams.List {
+					declared = append(declared, field.Names...)
+				}
+			}
+			for i, param := range params {
+				if i < len(declared) {
+					if typ, ok := spec.TypeParams[declared[i].Name]; ok {
+						typeParams[param.Name] = typ
+					}
+				}
+			}
+			field := &ast.Field{Doc: decl.Doc, Names: []*ast.Ident{decl.Name}, Type: decl.Type}
+			fn, err := fp.funcsig(field, typeParams, r.comments, r.docWrap, r.excludeComments)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, fn)
+		}
+	}
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("%s has no exported methods", iface)
+	}
+	return fns, nil
+}
+
+// receiverTypeName returns the name of the type of a method receiver
+// with type expression e, and the names it gives the type's parameters.
+func receiverTypeName(e ast.Expr) (string, []*ast.Ident) {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	var indices []ast.Expr
+	switch x := e.(type) {
+	case *ast.IndexExpr:
+		e, indices = x.X, []ast.Expr{x.Index}
+	case *ast.IndexListExpr:
+		e, indices = x.X, x.Indices
+	}
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return "", nil
+	}
+	var params []*ast.Ident
+	for _, index := range indices {
+		if param, ok := index.(*ast.Ident); ok {
+			params = append(params, param)
+		}
+	}
+	return id.Name, params
+}
+
+// methods returns the set of methods required to implement the
+// interface named iface, declared by spec in p.
+func (r *resolver) methods(iface string, p Pkg, spec Spec) ([]Func, error) {
+	p = r.withAliases(r.withRecvPkg(p))
+
+	idecl, ok := spec.Type.(*ast.InterfaceType)
 	if !ok {
-		return nil, fmt.Errorf("not an interface: %s", iface)
+		return nil, kindErrorf(ErrNotAnInterface, "not an interface: %s", iface)
+	}
+
+	if idecl.Methods == nil || len(idecl.Methods.List) == 0 {
+		return nil, kindErrorf(ErrEmptyInterface, "empty interface: %s", iface)
+	}
+
+	// Name the interface as its package does in errors about what it
+	// embeds, so that they read the same however deeply it's embedded.
+	embedder := iface
+	if spec.Name != nil && spec.Name.Name != "_" {
+		embedder = p.Package.Name + "." + spec.Name.Name
+	}
+	constraint := isConstraint(idecl)
+
+	var fns []Func
+	for _, fndecl := range idecl.Methods.List {
+		if len(fndecl.Names) == 0 {
+			switch t := fndecl.Type.(type) {
+			case *ast.BinaryExpr, *ast.UnaryExpr,
+				*ast.ArrayType, *ast.MapType, *ast.ChanType,
+				*ast.FuncType, *ast.StructType, *ast.StarExpr:
+				// Type-set element of a constraint, such as ~int | ~string
+				// or []byte. It has no methods.
+				continue
+			case *ast.InterfaceType:
+				// Inline interface, such as interface{}.
+				if t.Methods == nil || len(t.Methods.List) == 0 {
+					continue
+				}
+				inline := Spec{TypeSpec: &ast.TypeSpec{Type: t}, TypeParams: spec.TypeParams}
+				embedded, err := r.methods(embedder, p, inline)
+				if err != nil {
+					return nil, err
+				}
+				fns = append(fns, r.withEmbedComment(fndecl, embedded)...)
+				continue
+			}
+			// Embedded interface: recurse
+			embedded, err := r.embedded(embedder, constraint, p, fndecl.Type, spec.TypeParams)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, r.withEmbedComment(fndecl, embedded)...)
+			continue
+		}
+
+		if !fndecl.Names[0].IsExported() && p.recvPkg != "" && p.recvPkg != p.Package.Name {
+			// Only types in the interface's own package can implement it.
+			// Without a known receiver package, as for a receiver type
+			// not yet declared, assume that the receiver is in it.
+			if r.skipUnexported {
+				r.logf.printf("skipped unexported method %s of %s", fndecl.Names[0].Name, iface)
+				continue
+			}
+			return nil, fmt.Errorf("%s is sealed: its unexported method %s can only be implemented in package %s (use -skip-unexported to omit it)", iface, fndecl.Names[0].Name, p.Package.Name)
+		}
+
+		fn, err := p.funcsig(fndecl, spec.TypeParams, r.comments, r.docWrap, r.excludeComments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", iface, err)
+		}
+		r.logf.printf("method %s from %s", fn.Name, iface)
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
+
+// withRecvPkg returns p with the name of the package the stubs are
+// written in, r.recvPkg, and, if that is srcDir's package, its
+// directory and the names under which p.file imports it.
+func (r *resolver) withRecvPkg(p Pkg) Pkg {
+	p.recvPkg = r.recvPkg
+	p.recvDir, p.recvImports = "", nil
+	if r.recvPkg == "" {
+		return p
+	}
+	if r.pkgs == nil {
+		r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+	}
+	pp, err := r.pkgs.load("", r.srcDir)
+	if err != nil || pp.pkg.Name != r.recvPkg {
+		return p
+	}
+	p.recvDir = pp.pkg.Dir
+	if p.file == nil {
+		return p
+	}
+	p.recvImports = make(map[string]bool)
+	for _, imp := range p.file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || (imp.Name != nil && (imp.Name.Name == "_" || imp.Name.Name == ".")) {
+			continue
+		}
+		ip, err := r.pkgs.load(path, p.Dir)
+		if err != nil || !sameFile(ip.pkg.Dir, p.recvDir) {
+			continue
+		}
+		if imp.Name != nil {
+			p.recvImports[imp.Name.Name] = true
+		} else {
+			p.recvImports[ip.pkg.Name] = true
+		}
+	}
+	return p
+}
+
+// withAliases returns p with the aliases in r.aliases of p's own
+// package, unless p.name already overrides its name, and of the
+// packages that p.file imports.
+func (r *resolver) withAliases(p Pkg) Pkg {
+	if len(r.aliases) == 0 {
+		return p
+	}
+	if alias, ok := r.aliases[p.ImportPath]; ok && p.name == "" {
+		p.name = alias
+	}
+	p.aliases = make(map[string]string)
+	for _, pkg := range p.dotImports {
+		if alias, ok := r.aliases[pkg.ImportPath]; ok {
+			p.aliases[pkg.Name] = alias
+		}
+	}
+	if p.file == nil {
+		return p
+	}
+	for _, imp := range p.file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		alias, ok := r.aliases[path]
+		if !ok {
+			continue
+		}
+		if imp.Name != nil {
+			p.aliases[imp.Name.Name] = alias
+			continue
+		}
+		if r.pkgs == nil {
+			r.pkgs = &pkgCache{tests: r.tests, logf: r.logf, pkgName: r.pkgName}
+		}
+		if pp, err := r.pkgs.load(path, p.Dir); err == nil {
+			p.aliases[pp.pkg.Name] = alias
+		}
+	}
+	return p
+}
+
+// withEmbedComment returns fns, the methods contributed by the embedded
+// interface field f, with the doc comment of f, if any, prepended to the
+// comment of the first of them.
+func (r *resolver) withEmbedComment(f *ast.Field, fns []Func) []Func {
+	if r.comments != WithComments || f.Doc == nil || len(fns) == 0 {
+		return fns
+	}
+	doc := flattenDocComment(f, r.docWrap)
+	if r.excludeComments != nil && r.excludeComments.MatchString(doc) {
+		return fns
+	}
+	fns = append([]Func(nil), fns...)
+	fns[0].Comments = doc + fns[0].Comments
+	return fns
+}
+
+// embedded returns the set of methods required to implement the
+// interface e embedded in embedder, an interface declared in p.
+// An empty embedder stands for a reference to e outside an interface.
+// If embedder is a constraint, a non-interface e is a type-set element
+// with no methods; otherwise it is an error.
+//
+// Embedded interfaces are located relative to the declaring package,
+// rather than by name, so that they resolve regardless of srcDir and
+// keep their type arguments, as in GenericInterface1[int]. Type
+// arguments that refer to the embedding interface's type parameters
+// are substituted from typeParams.
+func (r *resolver) embedded(embedder string, constraint bool, p Pkg, e ast.Expr, typeParams map[string]string) ([]Func, error) {
+	iface := p.gofmt(e)
+
+	var typ Type
+	var typeArgs []ast.Expr
+	switch x := e.(type) {
+	case *ast.IndexExpr:
+		e, typeArgs = x.X, []ast.Expr{x.Index}
+	case *ast.IndexListExpr:
+		e, typeArgs = x.X, x.Indices
+	}
+	for _, arg := range typeArgs {
+		param, err := p.fullType(arg, typeParams)
+		if err != nil {
+			return nil, fmt.Errorf("embedded interface %s: %v", iface, err)
+		}
+		typ.Params = append(typ.Params, param)
+	}
+
+	var path, dir, name string
+	switch x := e.(type) {
+	case *ast.Ident:
+		if fns, ok := builtinInterfaces[x.Name]; ok && len(typeArgs) == 0 {
+			return fns, nil
+		}
+		if _, ok := types.Universe.Lookup(x.Name).(*types.TypeName); ok && len(typeArgs) == 0 {
+			return nil, typeTermError(embedder, constraint, iface, "predeclared type")
+		}
+		typ.Name = x.Name
+		dir = p.Dir
+		name = p.name
+		if pkg, ok := p.dotImports[x.Name]; ok {
+			dir, name = pkg.Dir, ""
+		}
+	case *ast.SelectorExpr:
+		id, ok := x.X.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("unsupported embedded interface: %s", iface)
+		}
+		var err error
+		path, err = r.pkgs.importPath(p.file, id.Name, p.Dir)
+		if err != nil {
+			return nil, kindErrorf(ErrInterfaceNotFound, "interface %s not found: %s", iface, err)
+		}
+		typ.Name = x.Sel.Name
+		dir = p.Dir
+	default:
+		return nil, fmt.Errorf("unsupported embedded interface: %s", iface)
+	}
+
+	ep, spec, err := r.pkgs.typeSpec(path, typ, dir)
+	if err != nil {
+		return nil, kindErrorf(ErrInterfaceNotFound, "interface %s not found: %s", iface, err)
+	}
+	ep.name = name
+	r.logf.printf("found embedded %s in %s", iface, ep.FileSet.Position(spec.Pos()).Filename)
+	switch spec.Type.(type) {
+	case *ast.InterfaceType:
+	case *ast.StructType:
+		return nil, typeTermError(embedder, constraint, iface, "struct type")
+	default:
+		return nil, typeTermError(embedder, constraint, iface, "non-interface type")
+	}
+	fns, err := r.methods(iface, ep, spec)
+	if errors.Is(err, ErrEmptyInterface) {
+		// Embedding an empty interface adds no methods.
+		return nil, nil
+	}
+	return fns, err
+}
+
+// isConstraint reports whether idecl has a union or ~ term,
+// which only a constraint interface may have.
+func isConstraint(idecl *ast.InterfaceType) bool {
+	for _, field := range idecl.Methods.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		switch field.Type.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			return true
+		}
+	}
+	return false
+}
+
+// typeTermError returns the error for embedding iface, a non-interface
+// type described by kind, in embedder. In a constraint, iface is a
+// type-set element, which adds no methods, so typeTermError returns nil.
+// Elsewhere, embedding it is far more likely to be a mistake carried
+// over from struct embedding.
+func typeTermError(embedder string, constraint bool, iface, kind string) error {
+	if constraint {
+		return nil
+	}
+	if embedder == "" {
+		return kindErrorf(ErrNotAnInterface, "not an interface: %s is a %s", iface, kind)
+	}
+	return kindErrorf(ErrNotAnInterface, "%s embeds %s, which is a %s, not an interface", embedder, iface, kind)
+}
+
+const stub = "{{if .Comments}}{{.Comments}}{{end}}" +
+	"func ({{.Recv}}) {{.Name}}" +
+	"({{if .Wrap}}\n{{end}}{{range .Params}}{{.Name}} {{.Type}},{{if $.Wrap}}\n{{else}} {{end}}{{end}})" +
+	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})" +
+	"{\n" + "{{.Body}}" + "\n}\n\n"
+
+var tmpl = template.Must(template.New("test").Parse(stub))
+
+// panicBody is the body of a generated stub that has nothing better to do.
+const panicBody = "panic(\"not implemented\") // TODO: Implement"
+
+// generator renders method stubs.
+type generator struct {
+	// delegate is the receiver field to which generated methods
+	// forward their calls. If empty, generated methods panic.
+	delegate string
+	// wrap is like delegate, but generated methods also report each
+	// call, with its args and results, to the receiver's record method:
+	//
+	//	func (r *Receiver) record(method string, args, results []interface{})
+	wrap string
+	// commentPrefix is prepended to the doc comment of each
+	// generated method that has one.
+	commentPrefix string
+	// body selects how the bodies of generated methods are written:
+	// panicMode (the default, used when empty), zeroMode or errReturnMode.
+	body string
+	// returns maps result types to the expressions returned for them
+	// in zeroMode and errReturnMode, overriding their zero values.
+	returns map[string]string
+	// ctxFirst moves context.Context params to the front of generated
+	// method signatures. Reordered methods no longer satisfy the
+	// interface; method bodies, such as delegating calls, still use
+	// the interface's parameter order.
+	ctxFirst bool
+	// ctxCheck makes panicking methods that accept a context.Context
+	// and return an error first return the context's error, if any,
+	// as methods in zeroMode always do. Those that return no error
+	// assign the context to _ instead.
+	ctxCheck bool
+	// noFormat disables gofmt formatting of the generated code.
+	// This is an escape hatch for when formatting fails.
+	noFormat bool
+	// typeNames names blank and unnamed params and results
+	// after their types, instead of leaving them blank.
+	typeNames bool
+	// prefix is prepended to the names of generated methods, as for
+	// adapters. Renamed methods no longer satisfy the interface, by
+	// design; delegated calls still use the interface's names, and
+	// implemented is keyed by the renamed names.
+	prefix string
+	// blankUnused assigns each named param to the blank identifier
+	// in methods that only panic, for linters that report unused
+	// params. The compiler itself doesn't mind them.
+	blankUnused bool
+	// maxLine, if positive, is the width beyond which a method's
+	// signature is wrapped, one param per line.
+	maxLine int
+	// nolint, if set, is the comma-separated list of linters named
+	// by a //nolint directive on each generated method.
+	nolint string
+	// resultNames selects how results are named: keepResults
+	// (the default, used when empty), noneResults or autoResults.
+	resultNames string
+	// resultStruct, if positive, is the number of results from which
+	// a method's results are wrapped in a struct type declared for it,
+	// as a scaffolding aid. Such methods no longer satisfy the interface.
+	resultStruct int
+	// nameComments rewrites each //-style doc comment to begin with
+	// the name of its method, as Go doc comments do.
+	nameComments bool
+}
+
+// Result naming modes.
+const (
+	// keepResults keeps the result names given by the interface.
+	keepResults = "keep"
+	// noneResults leaves results unnamed.
+	noneResults = "none"
+	// autoResults names results after their types, as -name-params
+	// does, replacing the names given by the interface.
+	autoResults = "auto"
+)
+
+// Body modes.
+const (
+	// panicMode generates methods that panic.
+	panicMode = "panic"
+	// zeroMode generates methods that return zero values,
+	// or the expressions registered for their result types.
+	// Methods that accept a context.Context and return an error
+	// first return the context's error, if any.
+	zeroMode = "zero"
+	// errReturnMode is like zeroMode, but methods whose last result
+	// is an error return errNotImplemented for it.
+	errReturnMode = "errreturn"
+)
+
+// errNotImplemented is the error returned by stubs in errReturnMode.
+const errNotImplemented = `errors.New("not implemented")`
+
+// genStubs prints nicely formatted method stubs
+// for fns using receiver expression recv,
+// using the default generator options.
+func genStubs(recv string, fns []Func, implemented map[string]bool) ([]byte, error) {
+	return (&generator{}).genStubs(recv, fns, implemented)
+}
+
+// genStubs prints nicely formatted method stubs
+// for fns using receiver expression recv.
+// genStubs won't generate stubs for
+// already implemented methods of receiver.
+// If the stubs cannot be formatted, as when recv is not
+// a valid receiver expression, genStubs returns them
+// unformatted along with the formatting error.
+func (g *generator) genStubs(recv string, fns []Func, implemented map[string]bool) ([]byte, error) {
+	if g.delegate != "" || g.wrap != "" {
+		// Delegating bodies refer to the receiver, so it needs a name.
+		recv = nameReceiver(recv)
+	}
+	var recvName string
+	if recvs := strings.Fields(recv); len(recvs) > 1 {
+		recvName = recvs[0]
+	}
+
+	// (r *recv) F(r string) {} => (r *recv) F(_ string)
+	fixParams := func(params []Param) {
+		for i, p := range params {
+			if p.Name == recvName {
+				params[i].Name = "_"
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for _, fn := range fns {
+		if implemented[g.prefix+fn.Name] {
+			continue
+		}
+
+		if g.typeNames {
+			fn.Params, fn.Res = nameFromTypes(fn.Params, fn.Res, recvName)
+		}
+		switch g.resultNames {
+		case noneResults:
+			fn.Res = unnamedParams(fn.Res)
+		case autoResults:
+			// The results are named first, so that they get the
+			// plainest names not already taken by the params.
+			fn.Res, _ = nameFromTypes(unnamedParams(fn.Res), fn.Params, recvName)
+		}
+		fn.Params, fn.Res = blankNames(fn.Params, token.IsKeyword), blankNames(fn.Res, token.IsKeyword)
+		sg := g
+		if g.resultStruct > 0 && len(fn.Res) >= g.resultStruct {
+			decl, typ, lit, err := g.resultStructDecl(recv, fn)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(decl)
+			fn.Res = []Param{{Type: typ}}
+			// Bodies that return zero values return the struct instead.
+			sg = new(generator)
+			*sg = *g
+			sg.returns = map[string]string{typ: lit}
+		}
+		named, body := sg.stubBody(fn, recvName)
+		if shadowed := shadowedNames(named, body); len(shadowed) > 0 {
+			// Params and results named after identifiers that the body
+			// refers to, such as panic or nil, would shadow them.
+			isShadowed := func(name string) bool { return shadowed[name] }
+			fn.Params, fn.Res = blankNames(fn.Params, isShadowed), blankNames(fn.Res, isShadowed)
+			named, body = sg.stubBody(fn, recvName)
+		}
+		fn = named
+		if g.ctxFirst {
+			fn.Params, _ = moveContextFirst(fn.Params)
+		}
+		if g.nameComments {
+			fn.Comments = nameComment(fn.Comments, g.prefix+fn.Name)
+		}
+		fn.Comments = prefixComment(fn.Comments, g.commentPrefix)
+		if g.nolint != "" {
+			// Linters apply a directive on its own line just above
+			// a declaration to the whole declaration. Like gofmt,
+			// set it off from the text of a //-style doc comment.
+			if strings.HasPrefix(fn.Comments, "//") {
+				fn.Comments += "//\n"
+			}
+			fn.Comments += "//nolint:" + g.nolint + "\n"
+		}
+		fixParams(fn.Params)
+		fixParams(fn.Res)
+		if g.blankUnused && body == panicBody {
+			body = blankAssignments(fn.Params) + body
+		}
+		fn.Name = g.prefix + fn.Name
+		meth := Method{Recv: recv, Func: fn, Body: body}
+		if g.maxLine > 0 && len(fn.Params) > 0 {
+			meth.Wrap = len("func ("+recv+") "+funcSignature(fn)+" {") > g.maxLine
+		}
+		tmpl.Execute(buf, meth)
+	}
+
+	if g.noFormat {
+		return buf.Bytes(), nil
+	}
+	pretty, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.Bytes(), err
+	}
+	return pretty, nil
+}
+
+// resultStructDecl returns the declaration of a struct type that holds
+// the results of fn, a method of receiver recv, along with the type as
+// the method returns it and the literal returned for it by bodies that
+// return zero values. The type is named after the receiver's type and
+// the method, as FileStatResults is for (*File).Stat, and its fields
+// after the results, exported, or after their types. A generic
+// receiver's type parameters are also those of the struct.
+func (g *generator) resultStructDecl(recv string, fn Func) (decl, typ, lit string, err error) {
+	recvType, typeParams, typeArgs, _, err := receiverTypeDecl(recv)
+	if err != nil {
+		return "", "", "", err
+	}
+	name := recvType + g.prefix + fn.Name + "Results"
+	typ = name + typeArgs
+
+	_, results := nameFromTypes(nil, fn.Res, "")
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s holds the results of %s.\n", name, g.prefix+fn.Name)
+	fmt.Fprintf(&buf, "type %s%s struct {\n", name, typeParams)
+	for _, r := range results {
+		fmt.Fprintf(&buf, "%s %s\n", exportedName(r.Name), r.Type)
+	}
+	buf.WriteString("}\n\n")
+
+	// Fields that zeroBody would return other than zero values for
+	// are set to the same expressions.
+	var fields []string
+	for i, expr := range g.results(Func{Res: results}) {
+		if expr != zeroValue(results[i].Type) {
+			fields = append(fields, exportedName(results[i].Name)+": "+expr)
+		}
+	}
+	lit = typ + "{" + strings.Join(fields, ", ") + "}"
+	return buf.String(), typ, lit, nil
+}
+
+// exportedName returns name with its first letter upper-cased.
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// overriddenFuncs returns the methods of fns with the given names,
+// in the order of fns. Every name must be that of a method in fns.
+func overriddenFuncs(fns []Func, names []string) ([]Func, error) {
+	want := make(map[string]bool)
+	for _, name := range names {
+		want[strings.TrimSpace(name)] = true
+	}
+	var overridden []Func
+	for _, fn := range fns {
+		if want[fn.Name] {
+			overridden = append(overridden, fn)
+			delete(want, fn.Name)
+		}
+	}
+	if len(want) > 0 {
+		var missing []string
+		for name := range want {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("not a method of the interface: %s", strings.Join(missing, ", "))
+	}
+	return overridden, nil
+}
+
+// stubBody returns the body of the stub for fn, and fn with the params
+// that the body refers to named, with recvName as the receiver's name.
+func (g *generator) stubBody(fn Func, recvName string) (Func, string) {
+	switch {
+	case g.delegate != "":
+		fn.Params = nameParams(fn.Params, recvName)
+		return fn, delegateBody(recvName+"."+g.delegate, fn)
+	case g.wrap != "":
+		fn.Params = nameParams(fn.Params, recvName)
+		return fn, wrapBody(recvName+"."+g.wrap, recvName+".record", fn)
+	case g.body == zeroMode || g.body == errReturnMode:
+		fn.Params = nameContextParam(fn.Params, recvName)
+		return fn, g.zeroBody(fn)
+	case g.ctxCheck:
+		fn.Params = nameContextParam(fn.Params, recvName)
+		check := g.contextCheck(fn)
+		if ctx := contextParam(fn.Params); check == "" && ctx >= 0 {
+			// With no error to return the context's through,
+			// at least mark the context as one to use.
+			check = "_ = " + fn.Params[ctx].Name + "\n"
+		}
+		return fn, check + panicBody
+	}
+	return fn, panicBody
+}
+
+// shadowedNames returns the names of the params and results of fn
+// that would shadow a predeclared identifier, such as panic or nil,
+// or the errors package, where body refers to it.
+func shadowedNames(fn Func, body string) map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range append(fn.Params[:len(fn.Params):len(fn.Params)], fn.Res...) {
+		if p.Name == "errors" || types.Universe.Lookup(p.Name) != nil {
+			names[p.Name] = true
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	shadowed := make(map[string]bool)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(body))
+	var s scanner.Scanner
+	s.Init(file, []byte(body), nil, 0)
+	prev := token.ILLEGAL
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Selectors, as in r.field.New, are not references.
+		if tok == token.IDENT && prev != token.PERIOD && names[lit] {
+			shadowed[lit] = true
+		}
+		prev = tok
+	}
+	return shadowed
+}
+
+// blankNames returns params, or a copy of it in which the params
+// whose names satisfy blank, such as Go keywords, are blank.
+func blankNames(params []Param, blank func(name string) bool) []Param {
+	var blanked []Param
+	for i, p := range params {
+		if !blank(p.Name) {
+			continue
+		}
+		if blanked == nil {
+			blanked = append([]Param(nil), params...)
+		}
+		blanked[i].Name = "_"
+	}
+	if blanked == nil {
+		return params
+	}
+	return blanked
+}
+
+// prefixFuncs returns a copy of fns with prefix prepended to their names.
+func prefixFuncs(fns []Func, prefix string) []Func {
+	if prefix == "" {
+		return fns
+	}
+	named := make([]Func, len(fns))
+	for i, fn := range fns {
+		fn.Name = prefix + fn.Name
+		named[i] = fn
+	}
+	return named
+}
+
+// funcSignature returns the signature of fn as it would appear
+// in an interface declaration, such as "Read(p []byte) (n int, err error)".
+func funcSignature(fn Func) string {
+	list := func(ps []Param) string {
+		var fields []string
+		for _, p := range ps {
+			if p.Name == "" {
+				fields = append(fields, p.Type)
+			} else {
+				fields = append(fields, p.Name+" "+p.Type)
+			}
+		}
+		return strings.Join(fields, ", ")
+	}
+	sig := fn.Name + "(" + list(fn.Params) + ")"
+	switch {
+	case len(fn.Res) == 0:
+		return sig
+	case len(fn.Res) == 1 && fn.Res[0].Name == "":
+		return sig + " " + fn.Res[0].Type
+	}
+	return sig + " (" + list(fn.Res) + ")"
+}
+
+// zeroBody returns a method body for fn that returns the
+// expressions registered in g.returns for its result types,
+// or their zero values.
+// If fn accepts a context.Context and returns an error,
+// the body first returns the context's error, if any.
+func (g *generator) zeroBody(fn Func) string {
+	if len(fn.Res) == 0 {
+		return "// TODO: Implement"
+	}
+	return g.contextCheck(fn) + "return " + strings.Join(g.results(fn), ", ") + " // TODO: Implement"
+}
+
+// results returns the expressions returned for fn's results
+// by zeroBody.
+func (g *generator) results(fn Func) []string {
+	var results []string
+	for i, r := range fn.Res {
+		expr, ok := g.returns[r.Type]
+		if !ok {
+			expr = zeroValue(r.Type)
+			if g.body == errReturnMode && i == len(fn.Res)-1 && r.Type == "error" {
+				expr = errNotImplemented
+			}
+		}
+		results = append(results, expr)
+	}
+	return results
+}
+
+// contextCheck returns a statement that returns the error of fn's
+// context.Context param, if it has been canceled, along with the
+// zero values of fn's other results. It returns "" if fn has no
+// context.Context param or does not return an error.
+func (g *generator) contextCheck(fn Func) string {
+	ctx := contextParam(fn.Params)
+	if ctx < 0 || len(fn.Res) == 0 || fn.Res[len(fn.Res)-1].Type != "error" {
+		return ""
+	}
+	results := g.results(fn)
+	results[len(results)-1] = "err"
+	return "if err := " + fn.Params[ctx].Name + ".Err(); err != nil {\n" +
+		"return " + strings.Join(results, ", ") + "\n" +
+		"}\n"
+}
+
+// constructors returns calls to the constructors declared in the
+// package in srcDir, keyed by the type they construct. A constructor
+// is a func named New... that takes no arguments and returns a single
+// result of a named type, or a pointer to one, such as
+//
+//	func NewClient() *Client
+//
+// Funcs such as NewError() error don't count: their results are
+// predeclared types, whose zero values should stay as they are.
+// If several construct the same type, the first one declared is used.
+func constructors(srcDir string) (map[string]string, error) {
+	pp, err := (*pkgCache)(nil).load("", srcDir)
+	if err != nil {
+		return nil, err
+	}
+	ctors := make(map[string]string)
+	for i := range pp.names {
+		f := pp.file(i)
+		if f == nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "New") ||
+				fn.Type.TypeParams.NumFields() > 0 || fn.Type.Params.NumFields() > 0 ||
+				fn.Type.Results.NumFields() != 1 || !isNamedType(fn.Type.Results.List[0].Type) {
+				continue
+			}
+			var buf bytes.Buffer
+			printer.Fprint(&buf, pp.fset, fn.Type.Results.List[0].Type)
+			if _, ok := ctors[buf.String()]; !ok {
+				ctors[buf.String()] = fn.Name.Name + "()"
+			}
+		}
+	}
+	return ctors, nil
+}
+
+// isNamedType reports whether e is a named type other than
+// a predeclared one, or a pointer to one.
+func isNamedType(e ast.Expr) bool {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	switch x := e.(type) {
+	case *ast.IndexExpr:
+		e = x.X
+	case *ast.IndexListExpr:
+		e = x.X
+	}
+	switch x := e.(type) {
+	case *ast.Ident:
+		_, predeclared := types.Universe.Lookup(x.Name).(*types.TypeName)
+		return !predeclared
+	case *ast.SelectorExpr:
+		return true
+	}
+	return false
+}
+
+// zeroValue returns an expression for the zero value of typ.
+func zeroValue(typ string) string {
+	switch typ {
+	case "bool":
+		return "false"
+	case "string":
+		return `""`
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"float32", "float64", "complex64", "complex128",
+		"byte", "rune":
+		return "0"
+	case "error", "any", "unsafe.Pointer":
+		return "nil"
+	}
+	for _, prefix := range []string{"*", "[]", "map[", "chan ", "chan<-", "<-chan", "func(", "interface{"} {
+		if strings.HasPrefix(typ, prefix) {
+			return "nil"
+		}
+	}
+	// Arrays, structs, and named types, whose underlying
+	// types we don't know.
+	return "*new(" + typ + ")"
+}
+
+// contextParam returns the index of the first context.Context
+// param in params, or -1 if there is none.
+func contextParam(params []Param) int {
+	for i, p := range params {
+		if p.Type == "context.Context" {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveContextFirst returns params with its first context.Context
+// param moved to the front, and reports whether any param moved.
+func moveContextFirst(params []Param) ([]Param, bool) {
+	i := contextParam(params)
+	if i <= 0 {
+		return params, false
+	}
+	moved := []Param{params[i]}
+	moved = append(moved, params[:i]...)
+	moved = append(moved, params[i+1:]...)
+	return moved, true
+}
+
+// nameContextParam returns a copy of params in which the first
+// context.Context param is named, so that it can be referred to.
+// Blank context params, and those that collide with the receiver
+// name recvName, are named "ctx".
+func nameContextParam(params []Param, recvName string) []Param {
+	i := contextParam(params)
+	if i < 0 {
+		return params
+	}
+	if name := params[i].Name; name != "" && name != "_" && name != recvName {
+		return params
+	}
+	named := append([]Param(nil), params...)
+	named[i].Name = "ctx"
+	for n := 2; named[i].Name == recvName || hasParam(params, named[i].Name); n++ {
+		named[i].Name = fmt.Sprintf("ctx%d", n)
+	}
+	return named
+}
+
+// hasParam reports whether params includes a param named name.
+func hasParam(params []Param, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixComment inserts prefix at the start of the text of comment,
+// which may be a '//'-style or '/*'-style comment.
+func prefixComment(comment, prefix string) string {
+	if comment == "" || prefix == "" {
+		return comment
+	}
+	if strings.HasPrefix(comment, "//") {
+		return "// " + prefix + strings.TrimPrefix(comment[2:], " ")
+	}
+	// Insert before the first non-space character of the block,
+	// preserving its indentation.
+	text := strings.TrimLeft(comment[2:], " \t\n")
+	return comment[:len(comment)-len(text)] + prefix + text
+}
+
+// nameComment returns the //-style doc comment of method name rewritten
+// to begin with name, as Go doc comments do: "// Returns the value."
+// becomes "// Get returns the value." A comment that already begins
+// with name, in any case, gets its exact spelling. Block comments,
+// directives and Deprecated notices are returned unchanged.
+func nameComment(comment, name string) string {
+	if !strings.HasPrefix(comment, "// ") {
+		return comment
+	}
+	text := comment[len("// "):]
+	word := text
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		word = text[:i]
+	}
+	if trimmed := strings.TrimRight(word, ".,:;"); strings.EqualFold(trimmed, name) {
+		return "// " + name + text[len(trimmed):]
+	}
+	if word == "" || word == "Deprecated:" {
+		return comment
+	}
+	// Lowercase the old first word, as in "Returns", but not an
+	// initialism, as in "URL".
+	r, size := utf8.DecodeRuneInString(word)
+	if next, _ := utf8.DecodeRuneInString(word[size:]); unicode.IsUpper(r) && !unicode.IsUpper(next) {
+		text = string(unicode.ToLower(r)) + text[size:]
+	}
+	return "// " + name + " " + text
+}
+
+// nameReceiver returns recv with a variable name,
+// derived from the first letter of its type if it has none.
+// For example, "*Server[T]" becomes "s *Server[T]".
+func nameReceiver(recv string) string {
+	recv = strings.TrimSpace(recv)
+	// Type parameter lists may contain spaces.
+	name, _, _ := strings.Cut(recv, "[")
+	if len(strings.Fields(name)) > 1 || name == "" {
+		return recv
+	}
+	typ := strings.TrimPrefix(recv, "*")
+	r, _ := utf8.DecodeRuneInString(typ)
+	return string(unicode.ToLower(r)) + " " + recv
+}
+
+// nameParams returns a copy of params in which blank and unnamed
+// params, and params that collide with the receiver name recvName,
+// are given distinct names so that they can be referred to.
+func nameParams(params []Param, recvName string) []Param {
+	taken := map[string]bool{recvName: true}
+	for _, p := range params {
+		taken[p.Name] = true
+	}
+	named := make([]Param, len(params))
+	for i, p := range params {
+		if p.Name == "" || p.Name == "_" || p.Name == recvName {
+			for n := i; ; n++ {
+				p.Name = fmt.Sprintf("arg%d", n)
+				if !taken[p.Name] {
+					break
+				}
+			}
+			taken[p.Name] = true
+		}
+		named[i] = p
+	}
+	return named
+}
+
+// nameFromTypes returns copies of params and results in which blank
+// and unnamed entries are named after their types, such as s for
+// string and r for io.Reader, with numeric suffixes as needed to keep
+// the names distinct from each other and from recvName.
+func nameFromTypes(params, results []Param, recvName string) ([]Param, []Param) {
+	taken := map[string]bool{recvName: true}
+	for _, p := range params {
+		taken[p.Name] = true
+	}
+	for _, p := range results {
+		taken[p.Name] = true
+	}
+	name := func(ps []Param) []Param {
+		named := make([]Param, len(ps))
+		for i, p := range ps {
+			if p.Name == "" || p.Name == "_" {
+				base := typeName(p.Type)
+				p.Name = base
+				for n := 2; taken[p.Name]; n++ {
+					p.Name = base + strconv.Itoa(n)
+				}
+				taken[p.Name] = true
+			}
+			named[i] = p
+		}
+		return named
+	}
+	return name(params), name(results)
+}
+
+// unnamedParams returns a copy of params without their names.
+func unnamedParams(params []Param) []Param {
+	unnamed := make([]Param, len(params))
+	for i, p := range params {
+		unnamed[i] = Param{Type: p.Type}
+	}
+	return unnamed
+}
+
+// typeName returns a short variable name for a value of type typ:
+// err for error, and otherwise the lowercased first letter of the
+// type's name, ignoring any package qualifier and pointer, slice,
+// and variadic markers.
+func typeName(typ string) string {
+	if typ == "error" {
+		return "err"
+	}
+	typ = strings.TrimLeft(typ, "*[]. ")
+	switch {
+	case strings.HasPrefix(typ, "map["):
+		return "m"
+	case strings.HasPrefix(typ, "func("):
+		return "f"
+	case strings.HasPrefix(typ, "chan") || strings.HasPrefix(typ, "<-chan"):
+		return "ch"
+	}
+	typ, _, _ = strings.Cut(typ, "[")
+	if i := strings.LastIndex(typ, "."); i >= 0 {
+		typ = typ[i+1:]
+	}
+	r, _ := utf8.DecodeRuneInString(typ)
+	if !unicode.IsLetter(r) {
+		return "v"
+	}
+	return string(unicode.ToLower(r))
+}
+
+// wrapBody returns a method body that forwards the call to fn
+// to the same method on target, like delegateBody, and passes the
+// method name, args and results to record before returning the results.
+func wrapBody(target, record string, fn Func) string {
+	var args, argVals []string
+	taken := make(map[string]bool)
+	for _, p := range fn.Params {
+		taken[p.Name] = true
+		arg := p.Name
+		if strings.HasPrefix(p.Type, "...") {
+			arg += "..."
+		}
+		args = append(args, arg)
+		argVals = append(argVals, p.Name)
+	}
+	for _, p := range fn.Res {
+		taken[p.Name] = true
+	}
+	var results []string
+	for i := range fn.Res {
+		name := fmt.Sprintf("res%d", i)
+		for n := len(fn.Res); taken[name]; n++ {
+			name = fmt.Sprintf("res%d", n)
+		}
+		taken[name] = true
+		results = append(results, name)
+	}
+
+	call := target + "." + fn.Name + "(" + strings.Join(args, ", ") + ")"
+	list := func(vals []string) string {
+		if len(vals) == 0 {
+			return "nil"
+		}
+		return "[]interface{}{" + strings.Join(vals, ", ") + "}"
+	}
+	rec := record + "(" + strconv.Quote(fn.Name) + ", " + list(argVals) + ", " + list(results) + ")"
+	if len(results) == 0 {
+		return call + "\n" + rec
+	}
+	return strings.Join(results, ", ") + " := " + call + "\n" +
+		rec + "\n" +
+		"return " + strings.Join(results, ", ")
+}
+
+// blankAssignments returns statements assigning each named param in
+// params to the blank identifier, one per line.
+func blankAssignments(params []Param) string {
+	var b strings.Builder
+	for _, p := range params {
+		if p.Name != "" && p.Name != "_" {
+			b.WriteString("_ = " + p.Name + "\n")
+		}
+	}
+	return b.String()
+}
+
+// delegateBody returns a method body that forwards the call to fn
+// to the same method on target, returning its results, if any.
+func delegateBody(target string, fn Func) string {
+	var args []string
+	for _, p := range fn.Params {
+		arg := p.Name
+		if strings.HasPrefix(p.Type, "...") {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+	call := target + "." + fn.Name + "(" + strings.Join(args, ", ") + ")"
+	if len(fn.Res) == 0 {
+		return call
+	}
+	return "return " + call
+}
+
+// genTests returns a table-driven test skeleton, in package pkg, with
+// a test for each of fns on each receiver in recvs. Imports are added
+// as if the file were in srcDir. The tables start out empty, so the
+// tests compile and pass until cases are added.
+func genTests(pkg string, recvs []string, fns []Func, srcDir string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "package %s\n\n", pkg)
+	for _, recv := range recvs {
+		if strings.Contains(recv, "[") {
+			return nil, fmt.Errorf("can't generate tests for generic receiver %q", recv)
+		}
+		fields := strings.Fields(recv)
+		typ := fields[len(fields)-1]
+		for _, fn := range fns {
+			buf.WriteString(testFunc(typ, fn))
+		}
+	}
+	return imports.Process(filepath.Join(srcDir, "impl_test.go"), buf.Bytes(), nil)
+}
+
+// testFunc returns a table-driven test of method fn on receiver type typ.
+// Params are fields of the table's args; results are compared to its
+// want fields, except for a final error result, whose presence is
+// compared to wantErr.
+func testFunc(typ string, fn Func) string {
+	base := strings.TrimPrefix(typ, "*")
+	params := nameParams(fn.Params, "")
+	res := fn.Res
+	var hasErr bool
+	if n := len(res); n > 0 && res[n-1].Type == "error" {
+		res, hasErr = res[:n-1], true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "func Test%s_%s(t *testing.T) {\n", base, fn.Name)
+	if len(params) > 0 {
+		b.WriteString("type args struct {\n")
+		for _, p := range params {
+			fmt.Fprintf(&b, "%s %s\n", p.Name, strings.Replace(p.Type, "...", "[]", 1))
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("tests := []struct {\nname string\n")
+	if len(params) > 0 {
+		b.WriteString("args args\n")
+	}
+	var got, want []string
+	for i, r := range res {
+		suffix := ""
+		if i > 0 {
+			suffix = strconv.Itoa(i)
+		}
+		got = append(got, "got"+suffix)
+		want = append(want, "want"+suffix)
+		fmt.Fprintf(&b, "want%s %s\n", suffix, r.Type)
+	}
+	if hasErr {
+		b.WriteString("wantErr bool\n")
+	}
+	b.WriteString("}{\n// TODO: Add test cases.\n}\n")
+
+	b.WriteString("for _, tt := range tests {\nt.Run(tt.name, func(t *testing.T) {\n")
+	if strings.HasPrefix(typ, "*") {
+		fmt.Fprintf(&b, "r := new(%s)\n", base)
+	} else {
+		fmt.Fprintf(&b, "var r %s\n", base)
+	}
+	var args []string
+	for _, p := range params {
+		arg := "tt.args." + p.Name
+		if strings.HasPrefix(p.Type, "...") {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+	call := "r." + fn.Name + "(" + strings.Join(args, ", ") + ")"
+	results := got
+	if hasErr {
+		results = append(results, "err")
+	}
+	if len(results) > 0 {
+		call = strings.Join(results, ", ") + " := " + call
+	}
+	b.WriteString(call + "\n")
+	if hasErr {
+		fmt.Fprintf(&b, "if (err != nil) != tt.wantErr {\n"+
+			"t.Errorf(\"%s.%s() error = %%v, wantErr %%v\", err, tt.wantErr)\n"+
+			"return\n}\n", base, fn.Name)
+	}
+	for i := range got {
+		fmt.Fprintf(&b, "if !reflect.DeepEqual(%s, tt.%s) {\n"+
+			"t.Errorf(\"%s.%s() %s = %%v, want %%v\", %s, tt.%s)\n}\n",
+			got[i], want[i], base, fn.Name, got[i], got[i], want[i])
+	}
+	b.WriteString("})\n}\n}\n\n")
+	return b.String()
+}
+
+// withModFlag returns goflags with its -mod flag set to mod,
+// replacing any -mod flag already present.
+// Package resolution shells out to the go command, which reads GOFLAGS,
+// so this is how we honor vendor and module modes.
+func withModFlag(goflags, mod string) (string, error) {
+	switch mod {
+	case "readonly", "vendor", "mod":
+	default:
+		return "", fmt.Errorf("invalid -mod value %q: must be readonly, vendor, or mod", mod)
+	}
+	fields := []string{"-mod=" + mod}
+	for _, f := range strings.Fields(goflags) {
+		if strings.HasPrefix(f, "-mod=") || strings.HasPrefix(f, "--mod=") {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// setModFlag sets the -mod flag of GOFLAGS to mod,
+// so that package resolution uses mod's mode.
+func setModFlag(mod string) error {
+	goflags, err := withModFlag(os.Getenv("GOFLAGS"), mod)
+	if err != nil {
+		return err
+	}
+	return os.Setenv("GOFLAGS", goflags)
+}
+
+// splitReceivers splits a comma-separated list of receiver expressions,
+// such as "a *A, b *B[K, V]". Commas within brackets belong to type
+// parameter lists and do not separate receivers.
+func splitReceivers(s string) []string {
+	var recvs []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				recvs = append(recvs, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(recvs, strings.TrimSpace(s[start:]))
+}
+
+// normalizeReceiver returns recv in canonical form, as gofmt would
+// print it, such as "r *R" for "  r   *R  ". Editors may pass receivers
+// with stray whitespace, comments or semicolons, which are dropped.
+// If recv is not a valid receiver expression even without them, it is
+// returned with only surrounding whitespace trimmed.
+func normalizeReceiver(recv string) string {
+	recv = strings.TrimSpace(recv)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(recv))
+	var s scanner.Scanner
+	s.Init(file, []byte(recv), nil, 0)
+	var toks []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON {
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		toks = append(toks, lit)
+	}
+	if len(toks) == 0 {
+		return recv
+	}
+
+	f, err := parser.ParseFile(fset, "", "package hack\nfunc ("+strings.Join(toks, " ")+") Foo()", 0)
+	if err != nil {
+		return recv
+	}
+	field := f.Decls[0].(*ast.FuncDecl).Recv.List[0]
+	var buf bytes.Buffer
+	for _, name := range field.Names {
+		buf.WriteString(name.Name + " ")
+	}
+	if err := printer.Fprint(&buf, fset, field.Type); err != nil {
+		return recv
+	}
+	return buf.String()
+}
+
+// validReceiver reports whether recv is a valid receiver expression.
+func validReceiver(recv string) bool {
+	if recv == "" {
+		// The parse will parse empty receivers, but we don't want to accept them,
+		// since it won't generate a usable code snippet.
+		return false
+	}
+	fset := token.NewFileSet()
+	_, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
+	return err == nil
+}
+
+// defaultRecvEnv is the environment variable naming the receiver
+// variable to use for receivers given without one, such as "*Server".
+const defaultRecvEnv = "IMPL_DEFAULT_RECV"
+
+// withReceiverName returns the valid receiver recv with its variable
+// named name, if recv does not name one already.
+func withReceiverName(recv, name string) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
+	if err != nil || len(f.Decls[0].(*ast.FuncDecl).Recv.List[0].Names) > 0 {
+		return recv
+	}
+	return name + " " + strings.TrimSpace(recv)
+}
+
+// checkReceiverTypeParams reports an error if recv names a type declared
+// in srcDir with a different number of type parameters than recv lists.
+// Receivers whose type cannot be found are not checked.
+func checkReceiverTypeParams(recv string, srcDir string) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
+	if err != nil {
+		return err
+	}
+	typ := f.Decls[0].(*ast.FuncDecl).Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	var got int
+	switch x := typ.(type) {
+	case *ast.IndexExpr:
+		got = 1
+	case *ast.IndexListExpr:
+		got = len(x.Indices)
+	}
+
+	name := getReceiverType(recv)
+	if want, ok := declaredTypeParams(name, srcDir); ok && got != want {
+		return fmt.Errorf("receiver %q has %d type parameters, but %s is declared with %d", recv, got, name, want)
+	}
+	return nil
+}
+
+// declaredTypeParams returns the number of type parameters of the type
+// named name declared in srcDir, and whether such a type was found.
+func declaredTypeParams(name string, srcDir string) (int, bool) {
+	pp, err := (*pkgCache)(nil).load("", srcDir)
+	if err != nil {
+		return 0, false
+	}
+	for i := range pp.names {
+		f := pp.file(i)
+		if f == nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if spec.Name.Name == name {
+					return spec.TypeParams.NumFields(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// scaffoldType returns the declaration of an empty struct type for
+// receiver recv, with a doc comment saying it implements iface, if
+// known, and a constructor for it. Type parameters of a generic
+// receiver are constrained by any.
+func scaffoldType(recv, iface string) ([]byte, error) {
+	name, typeParams, typeArgs, pointer, err := receiverTypeDecl(recv)
+	if err != nil {
+		return nil, err
+	}
+	result, value := name+typeArgs, name+typeArgs+"{}"
+	if pointer {
+		result, value = "*"+result, "&"+value
+	}
+
+	var buf bytes.Buffer
+	if iface != "" {
+		fmt.Fprintf(&buf, "// %s implements %s.\n", name, iface)
+	}
+	fmt.Fprintf(&buf, "type %s%s struct{}\n\n", name, typeParams)
+	fmt.Fprintf(&buf, "// New%s returns a new %s.\n", name, name)
+	fmt.Fprintf(&buf, "func New%s%s() %s {\nreturn %s\n}\n\n", name, typeParams, result, value)
+	return format.Source(buf.Bytes())
+}
+
+// embedIfaceType returns the declaration of a struct type for receiver
+// recv that embeds the interface types ifaces, written as they are
+// referred to in the receiver's package. The struct gets the methods
+// of the interfaces that it does not override from the interface
+// values it is given; calling any other one panics.
+func embedIfaceType(recv string, ifaces []string) ([]byte, error) {
+	name, typeParams, _, _, err := receiverTypeDecl(recv)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s embeds %s for the methods it does not override.\n", name, strings.Join(ifaces, " and "))
+	fmt.Fprintf(&buf, "type %s%s struct {\n%s\n}\n\n", name, typeParams, strings.Join(ifaces, "\n"))
+	return format.Source(buf.Bytes())
+}
+
+// receiverTypeDecl returns the name of the type of receiver recv, with
+// its type parameters as they are declared, each constrained by any,
+// and as they are passed as type arguments, such as "[K any, V any]"
+// and "[K, V]" for "r *Repo[K, V]", and whether recv is a pointer.
+func receiverTypeDecl(recv string) (name, typeParams, typeArgs string, pointer bool, err error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
+	if err != nil {
+		return "", "", "", false, err
+	}
+	typ := f.Decls[0].(*ast.FuncDecl).Recv.List[0].Type
+	star, pointer := typ.(*ast.StarExpr)
+	if pointer {
+		typ = star.X
+	}
+	name, params := receiverTypeName(typ)
+	if name == "" {
+		return "", "", "", false, fmt.Errorf("can't declare a type for receiver %q", recv)
+	}
+
+	var decl, args []string
+	for _, p := range params {
+		decl = append(decl, p.Name+" any")
+		args = append(args, p.Name)
+	}
+	if len(params) > 0 {
+		typeParams = "[" + strings.Join(decl, ", ") + "]"
+		typeArgs = "[" + strings.Join(args, ", ") + "]"
+	}
+	return name, typeParams, typeArgs, pointer, nil
+}
+
+// inferReceiverTypeParams returns recv with params, the type arguments
+// of the interface, appended as its type parameters, so that
+// "r *Repo" implementing Store[T] becomes "r *Repo[T]". recv is
+// returned unchanged if it already lists type parameters or if it
+// names a type in srcDir that is not generic or cannot be found.
+// Each type argument must be a distinct type parameter name: one that
+// names a predeclared type or a type declared in srcDir, as in
+// Store[string], would shadow that type in the generated methods.
+func inferReceiverTypeParams(recv string, params []string, srcDir string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
+	if err != nil {
+		return "", err
+	}
+	typ := f.Decls[0].(*ast.FuncDecl).Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if _, ok := typ.(*ast.Ident); !ok {
+		return recv, nil
+	}
+	name := getReceiverType(recv)
+	want, ok := declaredTypeParams(name, srcDir)
+	if !ok || want == 0 {
+		return recv, nil
+	}
+	if len(params) != want {
+		return "", fmt.Errorf("can't infer type parameters of receiver %q: %s is declared with %d type parameters, but the interface has %d type arguments", recv, name, want, len(params))
+	}
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if !token.IsIdentifier(p) {
+			return "", fmt.Errorf("can't infer type parameters of receiver %q: type argument %s is not a valid type parameter name", recv, p)
+		}
+		if _, ok := types.Universe.Lookup(p).(*types.TypeName); ok {
+			return "", fmt.Errorf("can't infer type parameters of receiver %q: type argument %s is a predeclared type, not a type parameter", recv, p)
+		}
+		if _, ok := declaredTypeParams(p, srcDir); ok {
+			return "", fmt.Errorf("can't infer type parameters of receiver %q: type argument %s is a type declared in the receiver's package, not a type parameter", recv, p)
+		}
+		if seen[p] {
+			return "", fmt.Errorf("can't infer type parameters of receiver %q: type argument %s is repeated", recv, p)
+		}
+		seen[p] = true
+	}
+	return strings.TrimSpace(recv) + "[" + strings.Join(params, ", ") + "]", nil
+}
+
+// flattenDocComment flattens the field doc comments to a string.
+// If width is positive, '//'-style comments longer than width are
+// wrapped at word boundaries.
+func flattenDocComment(f *ast.Field, width int) string {
+	var result strings.Builder
+	for _, c := range f.Doc.List {
+		// add an end-of-line character if this is '//'-style comment
+		if c.Text[1] == '/' {
+			for _, line := range wrapLineComment(c.Text, width) {
+				result.WriteString(line)
+				result.WriteString("\n")
+			}
+			continue
+		}
+		result.WriteString(dedentBlockComment(c.Text))
+	}
+
+	// for '/*'-style comments, make sure to append EOL character to the comment
+	// block
+	if s := result.String(); !strings.HasSuffix(s, "\n") {
+		result.WriteString("\n")
+	}
+
+	return result.String()
+}
+
+// dedentBlockComment removes the indentation common to the text lines
+// of the '/*'-style comment text, and the indentation of a closing line
+// that contains only "*/". Block comments otherwise keep the indentation
+// of the interface they were declared in, which is wrong once the comment
+// is placed at the top level. The result matches what gofmt produces.
+func dedentBlockComment(text string) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 {
+		return text
+	}
+	last := len(lines) - 1
+	closingOnly := strings.TrimSpace(lines[last]) == "*/"
+	body := lines[1:]
+	if closingOnly {
+		body = lines[1:last]
+	}
+	var indent string
+	first := true
+	for _, line := range body {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.TrimPrefix(lines[i], indent)
+	}
+	if closingOnly {
+		lines[last] = "*/"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLineComment splits the '//'-style comment text into lines
+// no longer than width, breaking at word boundaries.
+// Directives (such as //go:generate), preformatted lines,
+// and words longer than width are left intact.
+func wrapLineComment(text string, width int) []string {
+	body := strings.TrimPrefix(text, "// ")
+	if width <= 0 || len(text) <= width || body == text || strings.HasPrefix(body, " ") || strings.HasPrefix(body, "\t") {
+		return []string{text}
+	}
+	var lines []string
+	line := "//"
+	for _, word := range strings.Fields(body) {
+		if line != "//" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = "//"
+		}
+		line += " " + word
+	}
+	return append(lines, line)
+}
+
+// absSrcDir returns dir, the -dir flag, as an absolute path,
+// or the working directory if dir is empty.
+// Every lookup, from locating the interface to finding already
+// implemented methods, happens relative to -dir, so make it absolute
+// rather than leave each to interpret a relative path on its own.
+// If that fails, absSrcDir returns dir unchanged.
+func absSrcDir(dir string) string {
+	if dir == "" {
+		if wd, err := os.Getwd(); err == nil {
+			return wd
+		}
+		return dir
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, `
+impl generates method stubs for recv to implement iface.
+
+impl [-dir directory] <recv>[,<recv>...] <iface> [<iface>...]
+impl [-dir directory] -iface-at file:line:col <recv>
+impl -check <recv> <iface>
+
+`[1:])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, `
+
+Examples:
+
+impl 'f *File' io.Reader
+impl 'a *A, b *B' io.Reader
+impl 'r *R' golang.org/x/mod/sumdb.ClientOps@v0.14.0
+impl Murmur hash.Hash
+impl 'r *R' 'interface{ Foo(); Bar() int }'
+impl 'rw *RW' io.Reader io.Writer
+impl -dir $GOPATH/src/github.com/josharian/impl Murmur hash.Hash
+
+Don't forget the single quotes around the receiver type
+to prevent shell globbing.
+
+If `+defaultRecvEnv+` is set, receivers given without a variable,
+such as '*Server', are named after it. An explicit variable wins.
+
+Default flag values may be set, one "flag = value" per line,
+in `+configFile+` files in the home directory and in -dir.
+Flags given on the command line take precedence.
+`[1:])
+		os.Exit(2)
+	}
+	flag.Parse()
+
+	configDir := *flagSrcDir
+	if configDir == "" {
+		configDir = "."
+	}
+	if err := applyConfig(flag.CommandLine, configDir); err != nil {
+		fatal(err)
+	}
+
+	if *flagModified {
+		files, err := readOverlay(os.Stdin)
+		if err != nil {
+			fatal(fmt.Sprintf("reading -modified archive: %v", err))
+		}
+		overlay = files
+	}
+
+	if len(flag.Args()) < 2 && (*flagIfaceAt == "" || len(flag.Args()) < 1) {
+		flag.Usage()
+	}
+
+	if *flagMod != "" {
+		if err := setModFlag(*flagMod); err != nil {
+			fatal(err)
+		}
+	}
+
+	recvs, ifaces := splitReceivers(flag.Arg(0)), flag.Args()[1:]
+	iface := strings.Join(ifaces, ", ")
+	for i, recv := range recvs {
+		recvs[i] = normalizeReceiver(recv)
+	}
+	for _, recv := range recvs {
+		if !validReceiver(recv) {
+			fatal(fmt.Sprintf("invalid receiver: %q", recv))
+		}
+	}
+	if name := os.Getenv(defaultRecvEnv); name != "" {
+		if !token.IsIdentifier(name) {
+			fatal(fmt.Sprintf("invalid %s: %q is not an identifier", defaultRecvEnv, name))
+		}
+		for i, recv := range recvs {
+			recvs[i] = withReceiverName(recv, name)
+		}
+	}
+
+	if *flagBody != panicMode && *flagBody != zeroMode && *flagBody != errReturnMode {
+		fatal(fmt.Sprintf("invalid -body: %q", *flagBody))
 	}
 
-	if idecl.Methods == nil {
-		return nil, fmt.Errorf("empty interface: %s", iface)
+	switch *flagResultNames {
+	case keepResults, noneResults, autoResults:
+	default:
+		fatal(fmt.Sprintf("invalid -result-names: %q", *flagResultNames))
 	}
 
-	var fns []Func
-	for _, fndecl := range idecl.Methods.List {
-		if len(fndecl.Names) == 0 {
-			// Embedded interface: recurse
-			embedded, err := funcs(p.fullType(fndecl.Type), srcDir, recvPkg, comments)
+	if *flagUseConstructors && *flagBody == panicMode {
+		fatal("-use-constructors requires -body=zero or -body=errreturn")
+	}
+
+	var buildConstraint string
+	if *flagBuildTag != "" {
+		line, err := buildConstraintLine(*flagBuildTag)
+		if err != nil {
+			fatal(err)
+		}
+		buildConstraint = line + "\n\n"
+	}
+
+	if *flagDelegate != "" && *flagWrap != "" {
+		fatal("-delegate and -wrap are mutually exclusive")
+	}
+	if *flagEmbedIface != "" && *flagScaffold {
+		fatal("-embed-iface and -scaffold are mutually exclusive")
+	}
+	if *flagEmbedIface != "" && *flagIfaceAt != "" {
+		fatal("-embed-iface requires interface arguments")
+	}
+	if *flagResultStruct > 0 && (*flagDelegate != "" || *flagWrap != "") {
+		fatal("-result-struct is incompatible with -delegate and -wrap")
+	}
+	if *flagDryRun && *flagNew == "" {
+		fatal("-dry-run requires -new")
+	}
+	if *flagGoimports && *flagNoFormat {
+		fatal("-goimports and -no-format are mutually exclusive")
+	}
+
+	switch *flagColEncoding {
+	case byteCols, runeCols, utf16Cols:
+	default:
+		fatal(fmt.Sprintf("invalid -col-encoding: %q", *flagColEncoding))
+	}
+
+	*flagSrcDir = absSrcDir(*flagSrcDir)
+
+	if *flagInferRecvParams {
+		if *flagIfaceAt != "" {
+			fatal("-infer-recv-params requires an interface argument")
+		}
+		if len(ifaces) != 1 {
+			fatal("-infer-recv-params requires exactly one interface argument")
+		}
+		_, typ, err := findInterface(ifaces[0], *flagSrcDir)
+		if err != nil {
+			fatal(err)
+		}
+		for i, recv := range recvs {
+			recvs[i], err = inferReceiverTypeParams(recv, typ.Params, *flagSrcDir)
 			if err != nil {
-				return nil, err
+				fatal(err)
 			}
-			fns = append(fns, embedded...)
-			continue
 		}
+	}
 
-		fn := p.funcsig(fndecl, spec.TypeParams, spec.CommentMap.Filter(fndecl), comments)
-		fns = append(fns, fn)
+	for _, recv := range recvs {
+		if err := checkReceiverTypeParams(recv, *flagSrcDir); err != nil {
+			fatal(err)
+		}
 	}
-	return fns, nil
-}
 
-const stub = "{{if .Comments}}{{.Comments}}{{end}}" +
-	"func ({{.Recv}}) {{.Name}}" +
-	"({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
-	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})" +
-	"{\n" + "panic(\"not implemented\") // TODO: Implement" + "\n}\n\n"
+	// All receivers are declared in the same package,
+	// so the first one determines its name,
+	// unless the stubs are written to another package.
+	var declPkg string
+	if *flagOutPkg == "" {
+		receiver := getReceiverType(recvs[0])
+		pkgs := &pkgCache{tests: *flagTests, pkgName: *flagPkgName}
+		pkg, _, err := pkgs.typeSpec("", Type{Name: receiver}, *flagSrcDir)
+		if err == nil {
+			declPkg = pkg.Package.Name
+		}
+	}
+	recvPkg, warning := outputPackage(*flagOutPkg, *flagRecvPkg, declPkg)
+	if warning != "" {
+		fmt.Fprintln(os.Stderr, "warning: "+warning)
+	}
 
-var tmpl = template.Must(template.New("test").Parse(stub))
+	var logf logFunc
+	if *flagVerbose {
+		logf = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "impl: "+format+"\n", args...)
+		}
+	}
 
-// genStubs prints nicely formatted method stubs
-// for fns using receiver expression recv.
-// If recv is not a valid receiver expression,
-// genStubs will panic.
-// genStubs won't generate stubs for
-// already implemented methods of receiver.
-func genStubs(recv string, fns []Func, implemented map[string]bool) []byte {
-	var recvName string
-	if recvs := strings.Fields(recv); len(recvs) > 1 {
-		recvName = recvs[0]
+	r := &resolver{
+		srcDir:         *flagSrcDir,
+		recvPkg:        recvPkg,
+		comments:       EmitComments(*flagComments),
+		ifacePkg:       *flagIfacePkg,
+		tests:          *flagTests,
+		docWrap:        *flagDocWrap,
+		skipUnexported: *flagSkipUnexported,
+		fromType:       *flagFromType,
+		pkgName:        *flagPkgName,
+		aliases:        flagAliases,
+		logf:           logf,
+		firstMatch:     *flagFirstMatch,
+		warnf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+		},
+		colEncoding: *flagColEncoding,
+	}
+	if *flagExcludeComments != "" {
+		re, err := regexp.Compile(*flagExcludeComments)
+		if err != nil {
+			fatal(fmt.Sprintf("invalid -exclude-comments: %v", err))
+		}
+		r.excludeComments = re
+	}
+	var fns []Func
+	var err error
+	if *flagIfaceAt != "" {
+		fns, err = r.funcsAt(*flagIfaceAt)
+	} else {
+		fns, err = r.funcsOf(ifaces, *flagKeepGoing)
+	}
+	// With -keep-going, the interfaces that failed to resolve are
+	// reported after the stubs for the others, and impl exits 1.
+	var failed error
+	if err != nil && *flagKeepGoing && len(fns) > 0 {
+		failed, err = err, nil
+	}
+	if err != nil {
+		fatal(err)
+	}
+	reportFailed := func() {
+		if failed != nil {
+			fatal(failed)
+		}
 	}
 
-	// (r *recv) F(r string) {} => (r *recv) F(_ string)
-	fixParams := func(params []Param) {
-		for i, p := range params {
-			if p.Name == recvName {
-				params[i].Name = "_"
+	if *flagSigOnly {
+		for _, fn := range fns {
+			fmt.Println(funcSignature(fn))
+		}
+		reportFailed()
+		return
+	}
+
+	if *flagTest {
+		if recvPkg == "" {
+			fatal("-test needs the receiver's package name; use -recvpkg or -outpkg")
+		}
+		src, err := genTests(recvPkg, recvs, fns, *flagSrcDir)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Print(buildConstraint + string(src))
+		reportFailed()
+		return
+	}
+
+	// With -embed-iface, the embedded interfaces provide
+	// the methods that are not overridden.
+	var embedded []string
+	if *flagEmbedIface != "" {
+		for _, iface := range ifaces {
+			typ, err := r.ifaceType(iface)
+			if err != nil {
+				fatal(err)
 			}
+			embedded = append(embedded, typ)
+		}
+		fns, err = overriddenFuncs(fns, strings.Split(*flagEmbedIface, ","))
+		if err != nil {
+			fatal(err)
 		}
 	}
 
-	buf := new(bytes.Buffer)
-	for _, fn := range fns {
-		if implemented[fn.Name] {
+	if *flagUseConstructors {
+		// Explicit -return flags take precedence.
+		ctors, err := constructors(*flagSrcDir)
+		if err != nil {
+			fatal(err)
+		}
+		for typ, expr := range ctors {
+			if _, ok := flagReturns[typ]; !ok {
+				flagReturns[typ] = expr
+			}
+		}
+	}
+
+	g := &generator{
+		delegate:      *flagDelegate,
+		wrap:          *flagWrap,
+		commentPrefix: *flagCommentPrefix,
+		body:          *flagBody,
+		returns:       flagReturns,
+		ctxFirst:      *flagCtxFirst,
+		ctxCheck:      *flagCtxCheck,
+		noFormat:      *flagNoFormat,
+		typeNames:     *flagNameParams,
+		prefix:        *flagPrefix,
+		maxLine:       *flagMaxLine,
+		blankUnused:   *flagBlankUnused,
+		resultNames:   *flagResultNames,
+		nolint:        *flagNolint,
+		resultStruct:  *flagResultStruct,
+		nameComments:  *flagRewriteComments,
+	}
+	// With -new, the header and build constraint begin each new file
+	// instead of the output.
+	var preamble string
+	if *flagHeader && !*flagCheck {
+		preamble = generatedHeader(os.Args[1:])
+	}
+	if !*flagCheck {
+		preamble += buildConstraint
+	}
+	var newPkg string
+	if *flagNew != "" {
+		newPkg = newFilePackage(*flagNew, recvPkg)
+	} else {
+		fmt.Print(preamble)
+	}
+	// The receiver's methods carry the prefix, if any.
+	named := prefixFuncs(fns, g.prefix)
+	var incomplete bool
+	for _, recv := range recvs {
+		// Get list of already implemented funcs
+		implemented, err := implementedFuncs(named, recv, *flagSrcDir)
+		if err != nil {
+			fatal(err)
+		}
+		if *flagStrict {
+			mismatches, err := signatureMismatches(named, recv, *flagSrcDir)
+			if err != nil {
+				fatal(err)
+			}
+			if len(mismatches) > 0 {
+				fatal(strings.Join(mismatches, "\n"))
+			}
+		}
+
+		for _, fn := range named {
+			if implemented[fn.Name] {
+				logf.printf("skipped %s: already implemented by %s", fn.Name, recv)
+			}
+		}
+
+		if *flagCheck {
+			for _, fn := range named {
+				if implemented[fn.Name] {
+					continue
+				}
+				incomplete = true
+				if len(recvs) > 1 {
+					fmt.Print(getReceiverType(recv), ": ")
+				}
+				fmt.Println(funcSignature(fn))
+			}
 			continue
 		}
 
-		fixParams(fn.Params)
-		fixParams(fn.Res)
-		meth := Method{Recv: recv, Func: fn}
-		tmpl.Execute(buf, meth)
+		if g.ctxFirst {
+			for _, fn := range fns {
+				if _, moved := moveContextFirst(fn.Params); moved && !implemented[g.prefix+fn.Name] {
+					fmt.Fprintf(os.Stderr, "warning: -ctx-first reordered the params of %s, so %s no longer satisfies the interface\n", fn.Name, recv)
+				}
+			}
+		}
+		if g.resultStruct > 0 {
+			for _, fn := range fns {
+				if len(fn.Res) >= g.resultStruct && !implemented[g.prefix+fn.Name] {
+					fmt.Fprintf(os.Stderr, "warning: -result-struct wrapped the results of %s, so %s no longer satisfies the interface\n", fn.Name, recv)
+				}
+			}
+		}
+		if g.prefix != "" {
+			fmt.Fprintf(os.Stderr, "warning: -prefix renames the generated methods, so %s no longer satisfies the interface\n", recv)
+		}
+		src, err := g.genStubs(recv, fns, implemented)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: printing unformatted stubs: %v\n", err)
+		}
+		if _, declared := declaredTypeParams(getReceiverType(recv), *flagSrcDir); *flagScaffold && !declared {
+			decl, err := scaffoldType(recv, iface)
+			if err != nil {
+				fatal(err)
+			}
+			src = append(decl, src...)
+		}
+		if _, declared := declaredTypeParams(getReceiverType(recv), *flagSrcDir); embedded != nil && !declared {
+			decl, err := embedIfaceType(recv, embedded)
+			if err != nil {
+				fatal(err)
+			}
+			src = append(decl, src...)
+		}
+		if *flagGoimports && *flagNew == "" && err == nil {
+			if src, err = goimportsStubs(src, *flagSrcDir); err != nil {
+				fatal(err)
+			}
+		}
+		if g.body == errReturnMode && !*flagGoimports && *flagNew == "" && bytes.Contains(src, []byte(errNotImplemented)) {
+			fmt.Fprintf(os.Stderr, "note: the stubs for %s use errors.New; import \"errors\"\n", recv)
+		}
+		if *flagRegion {
+			src = wrapRegion(src)
+		}
+		var filename string
+		if *flagNew != "" {
+			filename = filepath.Join(*flagNew, snakeCase(getReceiverType(recv))+".go")
+			if src, err = newFile(filename, newPkg, preamble, src); err != nil {
+				fatal(err)
+			}
+		}
+		if *flagSpaces > 0 {
+			src = indentWithSpaces(src, *flagSpaces)
+		}
+		if filename != "" && *flagDryRun {
+			if err := previewNewFile(os.Stdout, filename, src); err != nil {
+				fatal(err)
+			}
+			continue
+		}
+		if filename != "" {
+			if err := writeNewFile(filename, src); err != nil {
+				fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "wrote %s\n", filename)
+			continue
+		}
+		fmt.Print(string(src))
+	}
+	reportFailed()
+	if incomplete {
+		os.Exit(1)
 	}
+}
 
-	pretty, err := format.Source(buf.Bytes())
+// newFile returns the contents of a new Go file, named filename, of
+// package pkg, that holds the stubs src after preamble, such as a
+// generated-code header. Imports for the stubs are added as goimports
+// would.
+func newFile(filename, pkg, preamble string, src []byte) ([]byte, error) {
+	file := preamble + "package " + pkg + "\n\n" + string(src)
+	return imports.Process(filename, []byte(file), nil)
+}
+
+// writeNewFile writes src to filename, which must not exist yet.
+func writeNewFile(filename string, src []byte) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if _, err := f.Write(src); err != nil {
+		f.Close()
+		return err
 	}
-	return pretty
+	return f.Close()
 }
 
-// validReceiver reports whether recv is a valid receiver expression.
-func validReceiver(recv string) bool {
-	if recv == "" {
-		// The parse will parse empty receivers, but we don't want to accept them,
-		// since it won't generate a usable code snippet.
-		return false
+// previewNewFile writes to w the contents src that writeNewFile would
+// write to filename, under a line saying so, instead of writing them.
+// Like writeNewFile, it fails if filename exists.
+func previewNewFile(w io.Writer, filename string, src []byte) error {
+	if _, err := os.Lstat(filename); err == nil {
+		return &fs.PathError{Op: "open", Path: filename, Err: fs.ErrExist}
 	}
-	fset := token.NewFileSet()
-	_, err := parser.ParseFile(fset, "", "package hack\nfunc ("+recv+") Foo()", 0)
-	return err == nil
+	if _, err := fmt.Fprintf(w, "--- dry run: would write %s ---\n", filename); err != nil {
+		return err
+	}
+	_, err := w.Write(src)
+	return err
 }
 
-// flattenDocComment flattens the field doc comments to a string
-func flattenDocComment(f *ast.Field) string {
-	var result strings.Builder
-	for _, c := range f.Doc.List {
-		result.WriteString(c.Text)
-		// add an end-of-line character if this is '//'-style comment
-		if c.Text[1] == '/' {
-			result.WriteString("\n")
+// newFilePackage returns the name of the package of a new file in dir:
+// that of the package already in dir, if any, or else recvPkg, or else
+// one derived from the name of dir.
+func newFilePackage(dir, recvPkg string) string {
+	if pkg, err := build.ImportDir(dir, 0); err == nil {
+		return pkg.Name
+	}
+	if recvPkg != "" {
+		return recvPkg
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	var name []rune
+	for _, r := range strings.ToLower(filepath.Base(abs)) {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) && len(name) > 0 {
+			name = append(name, r)
 		}
 	}
-
-	// for '/*'-style comments, make sure to append EOL character to the comment
-	// block
-	if s := result.String(); !strings.HasSuffix(s, "\n") {
-		result.WriteString("\n")
+	if len(name) == 0 || !token.IsIdentifier(string(name)) {
+		return "main"
 	}
-
-	return result.String()
+	return string(name)
 }
 
-func main() {
-	flag.Usage = func() {
-		fmt.Fprint(os.Stderr, `
-impl generates method stubs for recv to implement iface.
+// snakeCase returns name, a Go identifier, in snake case, as is
+// conventional for file names: MyType becomes my_type, and
+// HTTPServer becomes http_server.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
 
-impl [-dir directory] <recv> <iface>
+// goimportsStubs runs the stubs src through goimports, which precedes
+// them with an import declaration for the packages they refer to.
+// Packages are resolved as if the stubs were in a file in srcDir.
+func goimportsStubs(src []byte, srcDir string) ([]byte, error) {
+	opt := &imports.Options{Fragment: true, Comments: true, TabIndent: true, TabWidth: 8}
+	return imports.Process(filepath.Join(srcDir, "__go_impl__.go"), src, opt)
+}
 
-`[1:])
-		flag.PrintDefaults()
-		fmt.Fprint(os.Stderr, `
+// Markers delimiting the code generated with -region, so that tools
+// can replace it when regenerating it.
+const (
+	regionBegin = "// impl:begin"
+	regionEnd   = "// impl:end"
+)
 
-Examples:
+// wrapRegion returns src between regionBegin and regionEnd lines.
+// The markers are set off by blank lines, so that gofmt leaves them
+// alone and regionBegin doesn't become the doc comment of the first
+// declaration in src.
+func wrapRegion(src []byte) []byte {
+	src = bytes.TrimRight(src, "\n")
+	return []byte(regionBegin + "\n\n" + string(src) + "\n\n" + regionEnd + "\n")
+}
 
-impl 'f *File' io.Reader
-impl Murmur hash.Hash
-impl -dir $GOPATH/src/github.com/josharian/impl Murmur hash.Hash
+// outputPackage returns the name of the package that the stubs are
+// written in, which determines how their types are qualified. In order
+// of precedence, it is:
+//
+//   - outPkg, given by -outpkg, when the stubs are written elsewhere;
+//   - declPkg, the package that declares the receiver's type, if any,
+//     since its methods must be declared there too;
+//   - recvPkg, given by -recvpkg, for a type not yet declared.
+//
+// A recvPkg that contradicts declPkg is most likely misremembered,
+// so it is ignored, with a warning saying so.
+func outputPackage(outPkg, recvPkg, declPkg string) (name, warning string) {
+	switch {
+	case outPkg != "":
+		return outPkg, ""
+	case declPkg != "":
+		if recvPkg != "" && recvPkg != declPkg {
+			warning = fmt.Sprintf("ignoring -recvpkg %s: the receiver is declared in package %s (use -outpkg to write the stubs elsewhere)", recvPkg, declPkg)
+		}
+		return declPkg, warning
+	}
+	return recvPkg, ""
+}
 
-Don't forget the single quotes around the receiver type
-to prevent shell globbing.
-`[1:])
-		os.Exit(2)
+// indentWithSpaces replaces the leading tabs of each line of src
+// with n spaces apiece. Lines that begin inside a raw string literal
+// are part of its value, so they are left alone.
+func indentWithSpaces(src []byte, n int) []byte {
+	// Find the raw string literals.
+	var raw [][2]int
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING && strings.HasPrefix(lit, "`") {
+			start := file.Offset(pos)
+			raw = append(raw, [2]int{start, start + len(lit)})
+		}
+	}
+	inRaw := func(off int) bool {
+		for _, r := range raw {
+			if r[0] < off && off < r[1] {
+				return true
+			}
+		}
+		return false
 	}
-	flag.Parse()
 
-	if len(flag.Args()) < 2 {
-		flag.Usage()
+	indent := strings.Repeat(" ", n)
+	var buf bytes.Buffer
+	for off := 0; off < len(src); {
+		end := bytes.IndexByte(src[off:], '\n') + 1
+		if end == 0 {
+			end = len(src) - off
+		}
+		line := src[off : off+end]
+		if !inRaw(off) {
+			for len(line) > 0 && line[0] == '\t' {
+				buf.WriteString(indent)
+				line = line[1:]
+			}
+		}
+		buf.Write(line)
+		off += end
 	}
+	return buf.Bytes()
+}
+
+// configFile is the name of the files from which impl reads default
+// flag values, in the user's home directory and in the package's.
+// It holds TOML-style key = value lines, whose keys are flag names:
+//
+//	# Defaults for impl.
+//	comments = false
+//	body = "zero"
+//	return = ["error=errors.New(\"TODO\")"]
+const configFile = ".impl.toml"
+
+// configValue is a flag value read from a config file.
+type configValue struct {
+	line       int
+	key, value string
+}
+
+// applyConfig sets the flags in fs that were not set on the command
+// line from the config files in the user's home directory and in dir.
+// The package's config takes precedence over the user's.
+func applyConfig(fs *flag.FlagSet, dir string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-	recv, iface := flag.Arg(0), flag.Arg(1)
-	if !validReceiver(recv) {
-		fatal(fmt.Sprintf("invalid receiver: %q", recv))
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, configFile))
+	}
+	if path := filepath.Join(dir, configFile); len(paths) == 0 || !sameFile(path, paths[0]) {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		values, err := parseConfig(string(data))
+		if err != nil {
+			return fmt.Errorf("%s:%v", path, err)
+		}
+		for _, v := range values {
+			if set[v.key] {
+				continue
+			}
+			if fs.Lookup(v.key) == nil {
+				return fmt.Errorf("%s:%d: unknown flag %q", path, v.line, v.key)
+			}
+			if err := fs.Set(v.key, v.value); err != nil {
+				return fmt.Errorf("%s:%d: invalid value for %s: %v", path, v.line, v.key, err)
+			}
+		}
 	}
+	return nil
+}
+
+// sameFile reports whether paths a and b name the same file.
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
 
-	if *flagSrcDir == "" {
-		if dir, err := os.Getwd(); err == nil {
-			*flagSrcDir = dir
+// parseConfig parses the key = value lines of a config file. Values
+// are strings, in double or single quotes, arrays of strings, which
+// set a repeatable flag once per element, or bare words such as true
+// or 42. Errors are prefixed with their line number.
+func parseConfig(data string) ([]configValue, error) {
+	var values []configValue
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t[]\"'") {
+			return nil, fmt.Errorf("%d: expected key = value, found %q", n, line)
+		}
+		vals, rest, err := parseConfigValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", n, err)
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("%d: unexpected %q after value", n, rest)
+		}
+		for _, val := range vals {
+			values = append(values, configValue{line: n, key: key, value: val})
 		}
 	}
+	return values, nil
+}
 
-	recvPkg := *flagRecvPkg
-	if recvPkg == "" {
-		//  "   s *Struct   " , receiver: Struct
-		recvs := strings.Fields(recv)
-		receiver := recvs[len(recvs)-1] // note that this correctly handles "s *Struct" and "*Struct"
-		receiver = strings.TrimPrefix(receiver, "*")
-		pkg, _, err := typeSpec("", Type{Name: receiver}, *flagSrcDir)
-		if err == nil {
-			recvPkg = pkg.Package.Name
+// parseConfigValue parses the value at the start of s, returning its
+// elements and the rest of s.
+func parseConfigValue(s string) (vals []string, rest string, err error) {
+	if !strings.HasPrefix(s, "[") {
+		val, rest, err := parseConfigString(s)
+		return []string{val}, rest, err
+	}
+	s = strings.TrimSpace(s[1:])
+	for !strings.HasPrefix(s, "]") {
+		val, rest, err := parseConfigString(s)
+		if err != nil {
+			return nil, "", err
+		}
+		vals = append(vals, val)
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated array")
 		}
 	}
+	return vals, s[1:], nil
+}
 
-	fns, err := funcs(iface, *flagSrcDir, recvPkg, EmitComments(*flagComments))
-	if err != nil {
-		fatal(err)
+// parseConfigString parses the quoted string or bare word at the
+// start of s, returning it and the rest of s.
+func parseConfigString(s string) (val, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		prefix, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", s)
+		}
+		val, err := strconv.Unquote(prefix)
+		return val, s[len(prefix):], err
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
 	}
+	if end == 0 {
+		return "", "", fmt.Errorf("missing value")
+	}
+	return s[:end], s[end:], nil
+}
 
-	// Get list of already implemented funcs
-	implemented, err := implementedFuncs(fns, recv, *flagSrcDir)
+// buildConstraintLine returns the //go:build line for the build
+// constraint expr, such as "linux && amd64", in canonical form.
+func buildConstraintLine(expr string) (string, error) {
+	x, err := constraint.Parse("//go:build " + expr)
 	if err != nil {
-		fatal(err)
+		return "", fmt.Errorf("invalid build constraint %q: %v", expr, err)
 	}
+	return "//go:build " + x.String(), nil
+}
 
-	src := genStubs(recv, fns, implemented)
-	fmt.Print(string(src))
+// generatedHeader returns a comment marking code as generated by impl
+// with the command line arguments args, which include the receiver and
+// interface. It matches the convention described in 'go help generate'.
+func generatedHeader(args []string) string {
+	cmd := []string{"impl"}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t*[]$'\"\\") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		cmd = append(cmd, arg)
+	}
+	return "// Code generated by \"" + strings.Join(cmd, " ") + "\"; DO NOT EDIT.\n\n"
 }
 
 func fatal(msg interface{}) {
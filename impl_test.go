@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/josharian/impl/methods"
 	"github.com/josharian/impl/testdata"
+	"golang.org/x/tools/imports"
 )
 
 type errBool bool
@@ -30,13 +45,18 @@ func TestFindInterface(t *testing.T) {
 		{input: "net.Tennis", wantErr: true},
 		{input: "a + b", wantErr: true},
 		{input: "t[T,U]", path: "", typ: Type{Name: "t", Params: []string{"T", "U"}}},
+		{input: "t[*os.File]", path: "", typ: Type{Name: "t", Params: []string{"*os.File"}}},
 		{input: "a/b/c/", wantErr: true},
 		{input: "a/b/c/pkg", wantErr: true},
 		{input: "a/b/c/pkg.", wantErr: true},
 		{input: "a/b/c/pkg.Typ", path: "a/b/c/pkg", typ: Type{Name: "Typ"}},
 		{input: "gopkg.in/yaml.v2.Unmarshaler", path: "gopkg.in/yaml.v2", typ: Type{Name: "Unmarshaler"}},
+		{input: "./sub.Iface", path: "./sub", typ: Type{Name: "Iface"}},
+		{input: "../other.Iface", path: "../other", typ: Type{Name: "Iface"}},
+		{input: "./Iface", wantErr: true},
 		{input: "github.com/josharian/impl/testdata.GenericInterface1[string]", path: "github.com/josharian/impl/testdata", typ: Type{Name: "GenericInterface1", Params: []string{"string"}}},
 		{input: "github.com/josharian/impl/testdata.GenericInterface1[*string]", path: "github.com/josharian/impl/testdata", typ: Type{Name: "GenericInterface1", Params: []string{"*string"}}},
+		{input: "github.com/josharian/impl/testdata.GenericInterface1[*os.File]", path: "github.com/josharian/impl/testdata", typ: Type{Name: "GenericInterface1", Params: []string{"*os.File"}}},
 	}
 
 	for _, tt := range cases {
@@ -95,6 +115,48 @@ func TestTypeSpec(t *testing.T) {
 	}
 }
 
+func TestTypeSpecSuggestion(t *testing.T) {
+	cases := []struct {
+		path string
+		name string
+		want string
+	}{
+		{path: "net", name: "Con", want: "did you mean Conn?"},
+		{path: "io", name: "reader", want: "did you mean Reader?"},
+		{path: "io", name: "RaederFrom", want: "did you mean ReaderFrom?"},
+		{path: "io", name: "Closr", want: "did you mean Closer?"},
+	}
+	for _, tt := range cases {
+		_, _, err := typeSpec(tt.path, Type{Name: tt.name}, "")
+		if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("typeSpec(%q, %q).err=%v want suffix %q", tt.path, tt.name, err, tt.want)
+		}
+	}
+
+	_, _, err := typeSpec("io", Type{Name: "Banana"}, "")
+	if err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("typeSpec(io, Banana).err=%v want no suggestion", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"Reader", "Reader", 0},
+		{"Reder", "Reader", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range cases {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q)=%d want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
 func TestFuncs(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -341,6 +403,332 @@ func TestValidReceiver(t *testing.T) {
 	}
 }
 
+func TestNormalizeReceiver(t *testing.T) {
+	cases := []struct {
+		recv string
+		want string
+	}{
+		{recv: "r *R", want: "r *R"},
+		{recv: "  r   *R  ", want: "r *R"},
+		{recv: "r\t*R", want: "r *R"},
+		{recv: "r *R // from an editor", want: "r *R"},
+		{recv: "r /* receiver */ *R", want: "r *R"},
+		{recv: "r *R;", want: "r *R"},
+		{recv: "r *R[ K ,V ]", want: "r *R[K, V]"},
+		{recv: " *R[T] ", want: "*R[T]"},
+		{recv: " a+b ", want: "a+b"},
+		{recv: "", want: ""},
+	}
+	for _, tt := range cases {
+		got := normalizeReceiver(tt.recv)
+		if got != tt.want {
+			t.Errorf("normalizeReceiver(%q)=%q want %q", tt.recv, got, tt.want)
+		}
+	}
+}
+
+func TestSplitReceivers(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "r *Receiver", want: []string{"r *Receiver"}},
+		{in: "a *A,b *B", want: []string{"a *A", "b *B"}},
+		{in: "a *A[K, V], B", want: []string{"a *A[K, V]", "B"}},
+		{in: "r *Receiver ", want: []string{"r *Receiver"}},
+	}
+	for _, tt := range cases {
+		got := splitReceivers(tt.in)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitReceivers(%q)=%q want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckReceiverTypeParams(t *testing.T) {
+	cases := []struct {
+		recv    string
+		wantErr bool
+	}{
+		{recv: "r *Implemented"},
+		{recv: "r *ImplementedGeneric[T]"},
+		{recv: "r *ImplementedGenericMultipleParams[T, U]"},
+		{recv: "r *Unknown[T]"},
+		{recv: "r *Implemented[T]", wantErr: true},
+		{recv: "r *ImplementedGeneric", wantErr: true},
+		{recv: "r *ImplementedGenericMultipleParams[T]", wantErr: true},
+	}
+	for _, tt := range cases {
+		err := checkReceiverTypeParams(tt.recv, "testdata")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkReceiverTypeParams(%q).err=%v, wantErr %t", tt.recv, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInferReceiverTypeParams(t *testing.T) {
+	cases := []struct {
+		recv    string
+		params  []string
+		want    string
+		wantErr bool
+	}{
+		{recv: "r *ImplementedGeneric", params: []string{"T"}, want: "r *ImplementedGeneric[T]"},
+		{recv: "ImplementedGeneric ", params: []string{"string"}, wantErr: true},
+		{recv: "r *ImplementedGenericMultipleParams", params: []string{"T", "U"}, want: "r *ImplementedGenericMultipleParams[T, U]"},
+		{recv: "r *ImplementedGeneric[U]", params: []string{"T"}, want: "r *ImplementedGeneric[U]"},
+		{recv: "r *Implemented", params: []string{"T"}, want: "r *Implemented"},
+		{recv: "r *Unknown", params: []string{"T"}, want: "r *Unknown"},
+		{recv: "r *ImplementedGeneric", params: nil, wantErr: true},
+		{recv: "r *ImplementedGenericMultipleParams", params: []string{"T"}, wantErr: true},
+		{recv: "r *ImplementedGeneric", params: []string{"*os.File"}, wantErr: true},
+		{recv: "r *ImplementedGeneric", params: []string{"Struct5"}, wantErr: true},
+		{recv: "r *ImplementedGenericMultipleParams", params: []string{"int", "int"}, wantErr: true},
+		{recv: "r *ImplementedGenericMultipleParams", params: []string{"T", "T"}, wantErr: true},
+	}
+	for _, tt := range cases {
+		got, err := inferReceiverTypeParams(tt.recv, tt.params, "testdata")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("inferReceiverTypeParams(%q, %q).err=%v, wantErr %t", tt.recv, tt.params, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("inferReceiverTypeParams(%q, %q)=%q, want %q", tt.recv, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestOutPkg(t *testing.T) {
+	// The interface, the types it refers to and the stubs
+	// can each live in a different package.
+	cases := []struct {
+		outPkg string
+		srcDir string
+		want   string
+	}{
+		{outPkg: "adapter", srcDir: ".", want: "Convert(in testdata.Struct5, out *nested.Local) ([]testdata.Struct5, error)"},
+		{outPkg: "testdata", srcDir: "testdata", want: "Convert(in Struct5, out *nested.Local) ([]Struct5, error)"},
+		{outPkg: "nested", srcDir: "testdata/nested", want: "Convert(in testdata.Struct5, out *Local) ([]testdata.Struct5, error)"},
+		// Outside of package testdata, a package of that name
+		// may be another one.
+		{outPkg: "testdata", srcDir: ".", want: "Convert(in testdata.Struct5, out *nested.Local) ([]testdata.Struct5, error)"},
+	}
+	for _, tt := range cases {
+		fns, err := funcs("github.com/josharian/impl/testdata/nested.Interface24", tt.srcDir, tt.outPkg, WithoutComments)
+		if err != nil {
+			t.Fatalf("funcs(%q).err=%v", tt.outPkg, err)
+		}
+		if got := funcSignature(fns[0]); got != tt.want {
+			t.Errorf("outpkg %s in %s: got %s, want %s", tt.outPkg, tt.srcDir, got, tt.want)
+		}
+	}
+}
+
+func TestRecvPkgSharesImportName(t *testing.T) {
+	// The receiver's package is named http, but isn't net/http.
+	cases := []struct {
+		iface string
+		want  []string
+	}{
+		{iface: "net/http.Handler", want: []string{"ServeHTTP(_ http.ResponseWriter, _ *http.Request)"}},
+		{iface: "github.com/josharian/impl/testdata.Interface18", want: []string{
+			"Handler() func(w http.ResponseWriter, R *http.Request) (N int, Err error)",
+			"Struct() struct{ Name testdata.Struct5 }",
+		}},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, "testdata/httprecv", "http", WithoutComments)
+		if err != nil {
+			t.Fatalf("funcs(%q).err=%v", tt.iface, err)
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, funcSignature(fn))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q)=%q want %q", tt.iface, got, tt.want)
+		}
+	}
+}
+
+func TestInternalPackage(t *testing.T) {
+	const iface = "github.com/josharian/impl/testdata/internal/secret.Interface"
+	cases := []struct {
+		srcDir  string
+		wantErr bool
+	}{
+		{srcDir: "testdata"},
+		{srcDir: "testdata/nested"},
+		{srcDir: ".", wantErr: true},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(iface, tt.srcDir, "", WithoutComments)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "use of internal package") {
+				t.Errorf("funcs(%q) from %s: err=%v, want use of internal package error", iface, tt.srcDir, err)
+			}
+			continue
+		}
+		if err != nil || len(fns) != 1 {
+			t.Errorf("funcs(%q) from %s: fns=%v, err=%v", iface, tt.srcDir, fns, err)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	const data = `
+# Defaults for impl.
+comments = false
+body = "zero" # trailing comment
+comment-prefix = 'TODO: '
+return = ["error=errors.New(\"TODO\")", 'int=-1']
+`
+	want := []configValue{
+		{line: 3, key: "comments", value: "false"},
+		{line: 4, key: "body", value: "zero"},
+		{line: 5, key: "comment-prefix", value: "TODO: "},
+		{line: 6, key: "return", value: `error=errors.New("TODO")`},
+		{line: 6, key: "return", value: "int=-1"},
+	}
+	got, err := parseConfig(data)
+	if err != nil {
+		t.Fatalf("parseConfig.err=%v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseConfig=%+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{
+		"comments",
+		"body = ",
+		`body = "zero`,
+		"body = zero zero",
+		"return = [\"a\" \"b\"]",
+		"[impl]",
+	} {
+		if _, err := parseConfig(bad); err == nil {
+			t.Errorf("parseConfig(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	home, dir := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, configFile), []byte("body = \"zero\"\ncomments = false\ndoc-wrap = 60\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, configFile), []byte("doc-wrap = 80\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("impl", flag.ContinueOnError)
+	body := fs.String("body", panicMode, "")
+	comments := fs.Bool("comments", true, "")
+	docWrap := fs.Int("doc-wrap", 0, "")
+	if err := fs.Parse([]string{"-body=panic"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs, dir); err != nil {
+		t.Fatalf("applyConfig.err=%v", err)
+	}
+	// The command line beats the package's config, which beats the user's.
+	if *body != panicMode || *comments || *docWrap != 80 {
+		t.Errorf("body=%q comments=%t doc-wrap=%d, want panic false 80", *body, *comments, *docWrap)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, configFile), []byte("no-such-flag = 1\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(flag.NewFlagSet("impl", flag.ContinueOnError), dir); err == nil {
+		t.Errorf("applyConfig accepted an unknown flag")
+	}
+}
+
+func TestWithReceiverName(t *testing.T) {
+	cases := []struct {
+		recv string
+		want string
+	}{
+		{recv: "*Server", want: "s *Server"},
+		{recv: " Server ", want: "s Server"},
+		{recv: "*Repo[K, V]", want: "s *Repo[K, V]"},
+		{recv: "srv *Server", want: "srv *Server"},
+		{recv: "_ *Server", want: "_ *Server"},
+	}
+	for _, tt := range cases {
+		if got := withReceiverName(tt.recv, "s"); got != tt.want {
+			t.Errorf("withReceiverName(%q, \"s\")=%q want %q", tt.recv, got, tt.want)
+		}
+	}
+
+	// The default name takes part in renaming colliding params.
+	fns := []Func{{Name: "Write", Params: []Param{{Name: "p", Type: "[]byte"}}}}
+	src, err := genStubs(withReceiverName("*Server", "p"), fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	if want := "func (p *Server) Write(_ []byte)"; !strings.Contains(string(src), want) {
+		t.Errorf("genStubs output missing %q:\n%s", want, src)
+	}
+}
+
+func TestScaffoldType(t *testing.T) {
+	cases := []struct {
+		recv  string
+		iface string
+		want  string
+	}{
+		{
+			recv:  "r *Receiver",
+			iface: "io.Reader",
+			want: `// Receiver implements io.Reader.
+type Receiver struct{}
+
+// NewReceiver returns a new Receiver.
+func NewReceiver() *Receiver {
+	return &Receiver{}
+}
+
+`,
+		},
+		{
+			recv: "Receiver",
+			want: `type Receiver struct{}
+
+// NewReceiver returns a new Receiver.
+func NewReceiver() Receiver {
+	return Receiver{}
+}
+
+`,
+		},
+		{
+			recv:  "r *Repo[K, V]",
+			iface: "Store[K, V]",
+			want: `// Repo implements Store[K, V].
+type Repo[K any, V any] struct{}
+
+// NewRepo returns a new Repo.
+func NewRepo[K any, V any]() *Repo[K, V] {
+	return &Repo[K, V]{}
+}
+
+`,
+		},
+	}
+	for _, tt := range cases {
+		got, err := scaffoldType(tt.recv, tt.iface)
+		if err != nil {
+			t.Errorf("scaffoldType(%q).err=%v", tt.recv, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("scaffoldType(%q)=\n%s\nwant\n%s", tt.recv, got, tt.want)
+		}
+	}
+}
+
 func TestValidMethodComments(t *testing.T) {
 	cases := []struct {
 		iface string
@@ -446,7 +834,7 @@ func TestValidMethodComments(t *testing.T) {
 							Type: "error",
 						},
 					},
-					Comments: "/*\n\t\tMethod1 is the first method of Interface2.\n\t*/\n",
+					Comments: "/*\nMethod1 is the first method of Interface2.\n*/\n",
 				},
 				{
 					Name: "Method2",
@@ -470,7 +858,7 @@ func TestValidMethodComments(t *testing.T) {
 							Type: "error",
 						},
 					},
-					Comments: "/*\n\t\tMethod2 is the second method of Interface2.\n\t*/\n",
+					Comments: "/*\nMethod2 is the second method of Interface2.\n*/\n",
 				},
 				{
 					Name: "Method3",
@@ -494,7 +882,7 @@ func TestValidMethodComments(t *testing.T) {
 							Type: "error",
 						},
 					},
-					Comments: "/*\n\t\tMethod3 is the third method of Interface2.\n\t*/\n",
+					Comments: "/*\nMethod3 is the third method of Interface2.\n*/\n",
 				},
 			},
 		},
@@ -617,11 +1005,26 @@ func TestStubGeneration(t *testing.T) {
 			want:  testdata.Interface9Output,
 			dir:   ".",
 		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface29",
+			want:  testdata.Interface29Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.DotImportInterface",
+			want:  testdata.DotImportInterfaceOutput,
+			dir:   ".",
+		},
 		{
 			iface: "github.com/josharian/impl/testdata.GenericInterface1[string]",
 			want:  testdata.GenericInterface1Output,
 			dir:   ".",
 		},
+		{
+			iface: "Interface1",
+			want:  testdata.Interface1Output,
+			dir:   "testdata/nested",
+		},
 		{
 			iface: "GenericInterface1[string]",
 			want:  testdata.GenericInterface1Output,
@@ -647,6 +1050,81 @@ func TestStubGeneration(t *testing.T) {
 			want:  testdata.GenericInterface3Output,
 			dir:   "testdata",
 		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface12",
+			want:  testdata.Interface12Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata/nested.Interface12",
+			want:  testdata.Interface12Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.GenericInterface4[string]",
+			want:  testdata.GenericInterface4Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.GenericInterface5[*os.PathError]",
+			want:  testdata.GenericInterface5Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.GenericInterface6[string]",
+			want:  testdata.GenericInterface6Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface14",
+			want:  testdata.Interface14Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.GenericInterface7[float64]",
+			want:  testdata.GenericInterface7Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface15",
+			want:  testdata.Interface15Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface18",
+			want:  testdata.Interface18Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface25",
+			want:  testdata.Interface25Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata/yaml.v2.Unmarshaler",
+			want:  testdata.YAMLUnmarshalerOutput,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface26",
+			want:  testdata.Interface26Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface27",
+			want:  testdata.Interface27Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface22",
+			want:  testdata.Interface22Output,
+			dir:   ".",
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface23",
+			want:  testdata.Interface23Output,
+			dir:   ".",
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.iface, func(t *testing.T) {
@@ -654,7 +1132,10 @@ func TestStubGeneration(t *testing.T) {
 			if err != nil {
 				t.Errorf("funcs(%q).err=%v", tt.iface, err)
 			}
-			src := genStubs("r *Receiver", fns, nil)
+			src, err := genStubs("r *Receiver", fns, nil)
+			if err != nil {
+				t.Errorf("genStubs.err=%v", err)
+			}
 			if string(src) != tt.want {
 				t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%#v\nwant\n%#v\n", fns, string(src), tt.want)
 			}
@@ -759,7 +1240,10 @@ func TestStubGenerationForImplemented(t *testing.T) {
 			if err != nil {
 				t.Errorf("ifuncs.err=%v", err)
 			}
-			src := genStubs(tt.recv, fns, implemented)
+			src, err := genStubs(tt.recv, fns, implemented)
+			if err != nil {
+				t.Errorf("genStubs.err=%v", err)
+			}
 			if string(src) != tt.want {
 				t.Errorf("genStubs(\"r *Implemented\", %+#v).src=\n\n%#v\n\nwant\n\n%#v\n\n", fns, string(src), tt.want)
 			}
@@ -767,53 +1251,181 @@ func TestStubGenerationForImplemented(t *testing.T) {
 	}
 }
 
-func TestStubGenerationForRepeatedName(t *testing.T) {
+func TestImplementedFuncsCollidingNames(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "testdata", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
 	cases := []struct {
-		desc    string
-		iface   string
-		recv    string
-		recvPkg string
-		want    string
+		srcDir string
+		want   map[string]bool
 	}{
-		{
-			desc:    "receiver and in.Params with the same name",
-			iface:   "github.com/josharian/impl/testdata.Interface6",
-			recv:    "arg1 *Implemented",
-			recvPkg: "testdata",
-			want:    testdata.Interface7Output,
-		},
-		{
-			desc:    "receiver and out.Params with the same name",
-			iface:   "github.com/josharian/impl/testdata.Interface6",
-			recv:    "arg3 *Implemented",
-			recvPkg: "testdata",
-			want:    testdata.Interface8Output,
-		},
+		// testdata_test also declares an Implemented, with Method2.
+		{srcDir: "testdata", want: map[string]bool{"Method1": true}},
+		// nested declares no Implemented at all.
+		{srcDir: "testdata/nested", want: map[string]bool{}},
 	}
 	for _, tt := range cases {
-		t.Run(tt.desc, func(t *testing.T) {
-			fns, err := funcs(tt.iface, ".", tt.recvPkg, WithComments)
-			if err != nil {
-				t.Errorf("funcs(%q).err=%v", tt.iface, err)
-			}
-
-			implemented, err := implementedFuncs(fns, tt.recv, "testdata")
-			if err != nil {
-				t.Errorf("ifuncs.err=%v", err)
-			}
-			src := genStubs(tt.recv, fns, implemented)
-			if string(src) != tt.want {
-				t.Errorf("genStubs(\"r *Implemented\", %+#v).src=\n\n%#v\n\nwant\n\n%#v\n\n", fns, string(src), tt.want)
-			}
-		})
+		got, err := implementedFuncs(fns, "r *Implemented", tt.srcDir)
+		if err != nil {
+			t.Errorf("implementedFuncs(%q).err=%v", tt.srcDir, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("implementedFuncs(%q)=%v want %v", tt.srcDir, got, tt.want)
+		}
 	}
 }
 
-func TestParseTypeParams(t *testing.T) {
-	t.Parallel()
+func TestRerun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "store.go"), []byte("package store\n\ntype Store struct{}\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "store_impl.go")
 
-	cases := []struct {
-		desc    string
+	// generate writes the stubs that impl would print for iface to
+	// filename, as a user would, and returns them.
+	generate := func(iface string) string {
+		t.Helper()
+		fns, err := funcs(iface, ".", "store", WithoutComments)
+		if err != nil {
+			t.Fatalf("funcs(%s).err=%v", iface, err)
+		}
+		implemented, err := implementedFuncs(fns, "s *Store", dir)
+		if err != nil {
+			t.Fatalf("implementedFuncs(%s).err=%v", iface, err)
+		}
+		src, err := genStubs("s *Store", fns, implemented)
+		if err != nil {
+			t.Fatalf("genStubs(%s).err=%v", iface, err)
+		}
+		old, err := os.ReadFile(filename)
+		if err != nil {
+			old = []byte("package store\n\n")
+		}
+		file, err := format.Source(append(old, src...))
+		if err != nil {
+			t.Fatalf("format.Source(%s).err=%v", iface, err)
+		}
+		if err := os.WriteFile(filename, file, 0o666); err != nil {
+			t.Fatal(err)
+		}
+		return string(src)
+	}
+
+	if got := generate("io.ReadCloser"); !strings.Contains(got, "Read(") || !strings.Contains(got, "Close(") {
+		t.Fatalf("first run=\n%s\nwant Read and Close", got)
+	}
+	// The panicking stubs of the first run implement the interface.
+	if got := generate("io.ReadCloser"); strings.TrimSpace(got) != "" {
+		t.Errorf("second run=\n%s\nwant nothing", got)
+	}
+	// A second interface only adds the methods it doesn't share.
+	if got := generate("io.ReadWriter"); strings.Contains(got, "Read(") || !strings.Contains(got, "Write(") {
+		t.Errorf("run for io.ReadWriter=\n%s\nwant Write alone", got)
+	}
+	if got := generate("io.ReadWriteCloser"); strings.TrimSpace(got) != "" {
+		t.Errorf("run for io.ReadWriteCloser=\n%s\nwant nothing", got)
+	}
+
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"Read", "Write", "Close"} {
+		if n := strings.Count(string(file), ") "+method+"("); n != 1 {
+			t.Errorf("%s declared %d times, want once:\n%s", method, n, file)
+		}
+	}
+}
+
+func TestAbsoluteSrcDir(t *testing.T) {
+	// main resolves a relative -dir before anything else changes
+	// directory, so lookups keep working from elsewhere.
+	dir := absSrcDir("testdata")
+	if !filepath.IsAbs(dir) {
+		t.Fatalf("absSrcDir(testdata)=%q, want an absolute path", dir)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := absSrcDir(""); got != wd {
+		t.Errorf("absSrcDir(\"\")=%q want %q", got, wd)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	fns, err := funcs("Interface3", dir, "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	implemented, err := implementedFuncs(fns, "r *Implemented", dir)
+	if err != nil {
+		t.Fatalf("implementedFuncs.err=%v", err)
+	}
+	src, err := genStubs("r *Implemented", fns, implemented)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface4Output {
+		t.Errorf("genStubs(\"r *Implemented\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface4Output)
+	}
+}
+
+func TestStubGenerationForRepeatedName(t *testing.T) {
+	cases := []struct {
+		desc    string
+		iface   string
+		recv    string
+		recvPkg string
+		want    string
+	}{
+		{
+			desc:    "receiver and in.Params with the same name",
+			iface:   "github.com/josharian/impl/testdata.Interface6",
+			recv:    "arg1 *Implemented",
+			recvPkg: "testdata",
+			want:    testdata.Interface7Output,
+		},
+		{
+			desc:    "receiver and out.Params with the same name",
+			iface:   "github.com/josharian/impl/testdata.Interface6",
+			recv:    "arg3 *Implemented",
+			recvPkg: "testdata",
+			want:    testdata.Interface8Output,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.desc, func(t *testing.T) {
+			fns, err := funcs(tt.iface, ".", tt.recvPkg, WithComments)
+			if err != nil {
+				t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			}
+
+			implemented, err := implementedFuncs(fns, tt.recv, "testdata")
+			if err != nil {
+				t.Errorf("ifuncs.err=%v", err)
+			}
+			src, err := genStubs(tt.recv, fns, implemented)
+			if err != nil {
+				t.Errorf("genStubs.err=%v", err)
+			}
+			if string(src) != tt.want {
+				t.Errorf("genStubs(\"r *Implemented\", %+#v).src=\n\n%#v\n\nwant\n\n%#v\n\n", fns, string(src), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTypeParams(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		desc    string
 		input   string
 		want    Type
 		wantErr bool
@@ -882,3 +1494,1957 @@ func TestParseTypeParams(t *testing.T) {
 		})
 	}
 }
+
+func TestDocWrap(t *testing.T) {
+	r := &resolver{srcDir: ".", comments: WithComments, docWrap: 60}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface10")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err := genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface10Output {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface10Output)
+	}
+}
+
+func TestExcludeComments(t *testing.T) {
+	r := &resolver{srcDir: ".", comments: WithComments, excludeComments: regexp.MustCompile(`second`)}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface3")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := map[string]string{
+		"Method1": "// Method1 is the first method of Interface3.\n",
+		"Method2": "",
+		"Method3": "// Method3 is the third method of Interface3.\n",
+	}
+	for _, fn := range fns {
+		if fn.Comments != want[fn.Name] {
+			t.Errorf("%s.Comments=%q want %q", fn.Name, fn.Comments, want[fn.Name])
+		}
+	}
+}
+
+func TestIfacePkg(t *testing.T) {
+	r := &resolver{srcDir: ".", recvPkg: "testdata", comments: WithoutComments, ifacePkg: "td"}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface5")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := []Func{{
+		Name:   "Method2",
+		Params: []Param{{Name: "arg1", Type: "string"}, {Name: "arg2", Type: "td.Interface2"}, {Name: "arg3", Type: "td.Struct5"}},
+		Res:    []Param{{Type: "td.Interface3"}, {Type: "error"}},
+	}}
+	if !reflect.DeepEqual(fns, want) {
+		t.Errorf("funcs=%#v want %#v", fns, want)
+	}
+}
+
+func TestImportedInterface(t *testing.T) {
+	r := &resolver{srcDir: "testdata/ambiguous", recvPkg: "ambiguous", comments: WithoutComments}
+	_, err := r.funcs("Handler")
+	if !errors.Is(err, ErrAmbiguousInterface) {
+		t.Fatalf("funcs(Handler).err=%v want %v", err, ErrAmbiguousInterface)
+	}
+	for _, path := range []string{"net/http", "github.com/josharian/impl/testdata/ambiguous/handlers"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("funcs(Handler).err=%v, want it to list %s", err, path)
+		}
+	}
+
+	// Names that only one import declares resolve to it.
+	fns, err := r.funcs("Flusher")
+	if err != nil {
+		t.Fatalf("funcs(Flusher).err=%v", err)
+	}
+	if len(fns) != 1 || fns[0].Name != "Flush" {
+		t.Errorf("funcs(Flusher)=%v want Flush", fns)
+	}
+
+	var warnings []string
+	r = &resolver{srcDir: "testdata/ambiguous", recvPkg: "ambiguous", comments: WithoutComments, firstMatch: true}
+	r.warnf = func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	fns, err = r.funcs("Handler")
+	if err != nil {
+		t.Fatalf("funcs(Handler) with firstMatch: err=%v", err)
+	}
+	if len(fns) != 1 || fns[0].Name != "ServeHTTP" {
+		t.Errorf("funcs(Handler) with firstMatch=%v want ServeHTTP", fns)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings=%q want one", warnings)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	aliases := map[string]string{"net/http": "h", "github.com/josharian/impl/testdata": "td"}
+	r := &resolver{srcDir: ".", recvPkg: "other", comments: WithoutComments, aliases: aliases}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface18")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := []Func{
+		{Name: "Handler", Res: []Param{{Type: "func(w h.ResponseWriter, R *h.Request) (N int, Err error)"}}},
+		{Name: "Struct", Res: []Param{{Type: "struct{ Name td.Struct5 }"}}},
+	}
+	if !reflect.DeepEqual(fns, want) {
+		t.Errorf("funcs=%#v want %#v", fns, want)
+	}
+
+	got, err := r.ifaceType("net/http.Handler")
+	if err != nil {
+		t.Fatalf("ifaceType.err=%v", err)
+	}
+	if got != "h.Handler" {
+		t.Errorf("ifaceType=%q want %q", got, "h.Handler")
+	}
+
+	f := aliasesFlag{}
+	for _, bad := range []string{"net/http", "=h", "net/http=h.x"} {
+		if err := f.Set(bad); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestTests(t *testing.T) {
+	cases := []struct {
+		iface   string
+		srcDir  string
+		recvPkg string
+		want    []Func
+	}{
+		{
+			iface:   "github.com/josharian/impl/testdata.TestInterface",
+			srcDir:  ".",
+			recvPkg: "main",
+			want: []Func{{
+				Name:   "Method1",
+				Params: []Param{{Name: "arg", Type: "testdata.Struct5"}},
+				Res:    []Param{{Type: "error"}},
+			}},
+		},
+		{
+			iface:   "XTestInterface",
+			srcDir:  "testdata",
+			recvPkg: "testdata_test",
+			want: []Func{{
+				Name:   "Method1",
+				Params: []Param{{Name: "arg", Type: "testdata.Struct5"}},
+				Res:    []Param{{Type: "XTestStruct"}},
+			}},
+		},
+	}
+	for _, tt := range cases {
+		r := &resolver{srcDir: tt.srcDir, recvPkg: tt.recvPkg, comments: WithoutComments}
+		if _, err := r.funcs(tt.iface); err == nil {
+			t.Errorf("funcs(%q) without tests: want error, got nil", tt.iface)
+		}
+
+		r = &resolver{srcDir: tt.srcDir, recvPkg: tt.recvPkg, comments: WithoutComments, tests: true}
+		fns, err := r.funcs(tt.iface)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			continue
+		}
+		if !reflect.DeepEqual(fns, tt.want) {
+			t.Errorf("funcs(%q)=%#v want %#v", tt.iface, fns, tt.want)
+		}
+	}
+}
+
+func TestFullTypeIdempotent(t *testing.T) {
+	p, spec, err := typeSpec("github.com/josharian/impl/testdata", Type{Name: "Interface5"}, "")
+	if err != nil {
+		t.Fatalf("typeSpec.err=%v", err)
+	}
+	p.recvPkg = "main"
+	fn := spec.Type.(*ast.InterfaceType).Methods.List[0].Type.(*ast.FuncType)
+	arg := fn.Params.List[1].Type
+	for i := 0; i < 2; i++ {
+		got, err := p.fullType(arg, nil)
+		if want := "testdata.Interface2"; err != nil || got != want {
+			t.Errorf("fullType call %d=%q, %v want %q", i+1, got, err, want)
+		}
+	}
+	if got := arg.(*ast.Ident).Name; got != "Interface2" {
+		t.Errorf("fullType modified the AST: ident name=%q want %q", got, "Interface2")
+	}
+
+	// Types that don't print as valid Go are reported, not panicked on.
+	if got, err := p.fullType(&ast.Ident{Name: "not a type"}, nil); err == nil {
+		t.Errorf("fullType(invalid)=%q, want error", got)
+	}
+}
+
+func TestFuncsVersioned(t *testing.T) {
+	// golang.org/x/mod is a dependency, so this version is in the module cache.
+	const iface = "golang.org/x/mod/sumdb.ClientOps@v0.14.0"
+	fns, err := funcs(iface, ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs(%q).err=%v", iface, err)
+	}
+	var got []string
+	for _, fn := range fns {
+		got = append(got, fn.Name)
+	}
+	want := []string{"ReadRemote", "ReadConfig", "WriteConfig", "ReadCache", "WriteCache", "Log", "SecurityError"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("funcs(%q)=%q want %q", iface, got, want)
+	}
+
+	for _, iface := range []string{
+		"golang.org/x/mod/sumdb.ClientOps@v0.0.0-not-downloaded",
+		"ClientOps@v0.14.0",
+	} {
+		if _, err := funcs(iface, ".", "", WithoutComments); err == nil {
+			t.Errorf("funcs(%q): want error, got nil", iface)
+		}
+	}
+}
+
+func TestUnexportedMethods(t *testing.T) {
+	cases := []struct {
+		iface          string
+		srcDir         string
+		recvPkg        string
+		skipUnexported bool
+		want           []string
+		wantErr        bool
+	}{
+		{iface: "reflect.Type", recvPkg: "main", wantErr: true},
+		{iface: "github.com/josharian/impl/testdata.Interface16", recvPkg: "main", wantErr: true},
+		{iface: "github.com/josharian/impl/testdata.Interface16", recvPkg: "main", skipUnexported: true, want: []string{"Method1"}},
+		{iface: "github.com/josharian/impl/testdata.Interface16", recvPkg: "testdata", want: []string{"Method1", "method2"}},
+		// A receiver type that is not yet declared has no known package.
+		{iface: "Interface16", srcDir: "testdata", want: []string{"Method1", "method2"}},
+	}
+	for _, tt := range cases {
+		srcDir := tt.srcDir
+		if srcDir == "" {
+			srcDir = "."
+		}
+		r := &resolver{srcDir: srcDir, recvPkg: tt.recvPkg, comments: WithoutComments, skipUnexported: tt.skipUnexported}
+		fns, err := r.funcs(tt.iface)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("funcs(%q).err=%v want %s", tt.iface, err, errBool(tt.wantErr))
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, fn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q)=%q want %q", tt.iface, got, tt.want)
+		}
+	}
+}
+
+func TestFromType(t *testing.T) {
+	const iface = "github.com/josharian/impl/testdata.Concrete[string]"
+	r := &resolver{srcDir: ".", recvPkg: "testdata", comments: WithComments}
+	if _, err := r.funcs(iface); !errors.Is(err, ErrNotAnInterface) {
+		t.Errorf("funcs(%q).err=%v, want ErrNotAnInterface", iface, err)
+	}
+	r.fromType = true
+	fns, err := r.funcs(iface)
+	if err != nil {
+		t.Fatalf("funcs(%q).err=%v", iface, err)
+	}
+	src, err := genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.ConcreteOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.ConcreteOutput)
+	}
+	// Interfaces are still implemented as usual.
+	fns, err = r.funcs("github.com/josharian/impl/testdata.Interface3")
+	if err != nil || len(fns) != 3 {
+		t.Errorf("funcs(Interface3)=%v, %v", fns, err)
+	}
+}
+
+func TestVerbose(t *testing.T) {
+	var logged []string
+	r := &resolver{srcDir: "testdata", comments: WithoutComments}
+	r.logf = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	if _, err := r.funcs("Interface17"); err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	got := strings.Join(logged, "\n")
+	for _, want := range []string{
+		"loaded package testdata from ",
+		"found Interface17 in ",
+		"found embedded Interface3 in ",
+		"method Method1 from Interface3",
+		"method Method4 from Interface17",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  error
+	}{
+		{iface: "io.NoSuchInterface", want: ErrInterfaceNotFound},
+		{iface: "github.com/josharian/impl/testdata.NoSuchInterface", want: ErrInterfaceNotFound},
+		{iface: "github.com/josharian/impl/testdata.Struct5", want: ErrNotAnInterface},
+		{iface: "github.com/josharian/impl/testdata.EmptyInterface", want: ErrEmptyInterface},
+		{iface: "any", want: ErrEmptyInterface},
+		{iface: "comparable", want: ErrNotAnInterface},
+	}
+	for _, tt := range cases {
+		_, err := funcs(tt.iface, ".", "", WithComments)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("funcs(%q).err=%v, want %v", tt.iface, err, tt.want)
+		}
+	}
+}
+
+func TestBuiltinInterfaces(t *testing.T) {
+	for name, want := range builtinInterfaces {
+		fns, err := funcs(name, ".", "", WithComments)
+		if name == "comparable" {
+			if want := "comparable is a constraint and cannot be implemented"; err == nil || err.Error() != want {
+				t.Errorf("funcs(%q).err=%v, want %q", name, err, want)
+			}
+			continue
+		}
+		if len(want) == 0 {
+			if !errors.Is(err, ErrEmptyInterface) {
+				t.Errorf("funcs(%q).err=%v, want ErrEmptyInterface", name, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(fns, want) {
+			t.Errorf("funcs(%q)=%v, %v want %v", name, fns, err, want)
+		}
+	}
+	// Other small interfaces are resolved from source, as usual.
+	fns, err := funcs("fmt.Stringer", ".", "", WithoutComments)
+	if want := []Func{{Name: "String", Res: []Param{{Type: "string"}}}}; err != nil || !reflect.DeepEqual(fns, want) {
+		t.Errorf("funcs(fmt.Stringer)=%v, %v want %v", fns, err, want)
+	}
+}
+
+func TestEmbeddedSibling(t *testing.T) {
+	r := &resolver{srcDir: ".", recvPkg: "testdata", comments: WithoutComments}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface17")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	var got []string
+	for _, fn := range fns {
+		got = append(got, fn.Name)
+	}
+	if want := []string{"Method1", "Method2", "Method3", "Method4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("funcs=%q want %q", got, want)
+	}
+	// Interface3 resolves within the loaded package, without findInterface.
+	if len(r.ifaces) != 1 {
+		t.Errorf("findInterface was called for %d interfaces, want 1: %v", len(r.ifaces), r.ifaces)
+	}
+}
+
+func TestFuncsRelativePath(t *testing.T) {
+	cases := []struct {
+		iface  string
+		srcDir string
+		want   []string
+	}{
+		{iface: "./nested.Interface12", srcDir: "testdata", want: []string{"Method1", "Method2", "Method3", "Extra"}},
+		{iface: "./testdata/nested.Interface12", srcDir: ".", want: []string{"Method1", "Method2", "Method3", "Extra"}},
+		{iface: "../../testdata.Interface3", srcDir: "testdata/nested", want: []string{"Method1", "Method2", "Method3"}},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, tt.srcDir, "", WithoutComments)
+		if err != nil {
+			t.Errorf("funcs(%q, %q).err=%v", tt.iface, tt.srcDir, err)
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, fn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q, %q)=%q want %q", tt.iface, tt.srcDir, got, tt.want)
+		}
+	}
+}
+
+func TestTypeSetElements(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  []string
+	}{
+		{iface: "Interface14", want: []string{"String"}},
+		{iface: "Interface19", want: []string{"Method1"}},
+		{iface: "Interface20", want: []string{"Method1"}},
+		{iface: "Interface21", want: []string{"Method1"}},
+	}
+	for _, tt := range cases {
+		iface := "github.com/josharian/impl/testdata." + tt.iface
+		fns, err := funcs(iface, ".", "testdata", WithoutComments)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", iface, err)
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, fn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q)=%q want %q", iface, got, tt.want)
+		}
+	}
+	if _, err := funcs("github.com/josharian/impl/testdata.Number", ".", "testdata", WithoutComments); !errors.Is(err, ErrNotAnInterface) {
+		t.Errorf("funcs(Number).err=%v want %v", err, ErrNotAnInterface)
+	}
+}
+
+func TestEmbeddedNonInterface(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  string
+	}{
+		{iface: "Interface31", want: "testdata.Interface31 embeds Struct5, which is a struct type, not an interface"},
+		{iface: "Interface32", want: "testdata.Interface31 embeds Struct5, which is a struct type, not an interface"},
+		{iface: "Interface34", want: "testdata.Interface34 embeds Number, which is a non-interface type, not an interface"},
+		{iface: "Interface35", want: "testdata.Interface35 embeds int, which is a predeclared type, not an interface"},
+	}
+	for _, tt := range cases {
+		iface := "github.com/josharian/impl/testdata." + tt.iface
+		_, err := funcs(iface, ".", "testdata", WithoutComments)
+		if !errors.Is(err, ErrNotAnInterface) {
+			t.Errorf("funcs(%q).err=%v want %v", iface, err, ErrNotAnInterface)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("funcs(%q).err=%q want %q", iface, err, tt.want)
+		}
+	}
+}
+
+func TestFuncsigMethodTypeParams(t *testing.T) {
+	// The parser rejects type parameters on interface methods,
+	// so construct the AST by hand.
+	field := &ast.Field{
+		Names: []*ast.Ident{ast.NewIdent("Map")},
+		Type: &ast.FuncType{
+			TypeParams: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("T")},
+				Type:  ast.NewIdent("any"),
+			}}},
+			Params: &ast.FieldList{},
+		},
+	}
+	_, err := Pkg{}.funcsig(field, nil, WithComments, 0, nil)
+	if err == nil {
+		t.Fatal("funcsig of method with type parameters: want error, got nil")
+	}
+	if !strings.Contains(err.Error(), "type parameters") {
+		t.Errorf("funcsig.err=%v, want mention of type parameters", err)
+	}
+}
+
+func TestWithModFlag(t *testing.T) {
+	cases := []struct {
+		goflags string
+		mod     string
+		want    string
+		wantErr bool
+	}{
+		{goflags: "", mod: "vendor", want: "-mod=vendor"},
+		{goflags: "-mod=mod", mod: "vendor", want: "-mod=vendor"},
+		{goflags: "-trimpath -mod=readonly -v", mod: "mod", want: "-mod=mod -trimpath -v"},
+		{goflags: "", mod: "bogus", wantErr: true},
+	}
+
+	for _, tt := range cases {
+		got, err := withModFlag(tt.goflags, tt.mod)
+		gotErr := err != nil
+		if tt.wantErr != gotErr {
+			t.Errorf("withModFlag(%q, %q).err=%v want %s", tt.goflags, tt.mod, err, errBool(tt.wantErr))
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("withModFlag(%q, %q)=%q want %q", tt.goflags, tt.mod, got, tt.want)
+		}
+	}
+}
+
+func TestStubGenerationDelegate(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	fns = append(fns, Func{
+		Name:   "Printf",
+		Params: []Param{{Name: "r", Type: "string"}, {Name: "args", Type: "...interface{}"}},
+	})
+	g := &generator{delegate: "inner"}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface3DelegateOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface3DelegateOutput)
+	}
+}
+
+func TestGroupedParams(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface27", ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := []Func{
+		{
+			Name:   "Grouped",
+			Params: []Param{{Name: "a", Type: "testdata.Struct5"}, {Name: "b", Type: "testdata.Struct5"}},
+			Res:    []Param{{Name: "x", Type: "testdata.Struct5"}, {Name: "y", Type: "testdata.Struct5"}, {Name: "z", Type: "testdata.Struct5"}},
+		},
+		{
+			Name:   "Anonymous",
+			Params: []Param{{Name: "_", Type: "testdata.Struct5"}, {Name: "_", Type: "*testdata.Struct5"}},
+			Res:    []Param{{Type: "testdata.Struct5"}, {Type: "[]testdata.Struct5"}, {Type: "error"}},
+		},
+	}
+	if !reflect.DeepEqual(fns, want) {
+		t.Errorf("funcs=%+v\nwant %+v", fns, want)
+	}
+}
+
+func TestStubGenerationWrap(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	fns = append(fns, Func{
+		Name:   "Printf",
+		Params: []Param{{Name: "r", Type: "string"}, {Name: "args", Type: "...interface{}"}},
+	})
+	g := &generator{wrap: "inner"}
+	src, err := g.genStubs("*Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface3WrapOutput {
+		t.Errorf("genStubs(\"*Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface3WrapOutput)
+	}
+}
+
+func TestStubGenerationPrefix(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{delegate: "inner", prefix: "Legacy"}
+	src, err := g.genStubs("r *Receiver", fns, map[string]bool{"LegacyMethod1": true})
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	got := string(src)
+	if strings.Contains(got, "LegacyMethod1(") {
+		t.Errorf("genStubs generated implemented method LegacyMethod1:\n%s", got)
+	}
+	for _, want := range []string{"func (r *Receiver) LegacyMethod2(", "r.inner.Method2(", "func (r *Receiver) LegacyMethod3("} {
+		if !strings.Contains(got, want) {
+			t.Errorf("genStubs output missing %q:\n%s", want, got)
+		}
+	}
+	if named := prefixFuncs(fns, "Legacy"); named[0].Name != "LegacyMethod1" || fns[0].Name != "Method1" {
+		t.Errorf("prefixFuncs renamed to %q, original %q", named[0].Name, fns[0].Name)
+	}
+}
+
+func TestStubGenerationBlankUnused(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{blankUnused: true}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface3BlankUnusedOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface3BlankUnusedOutput)
+	}
+}
+
+func TestStubGenerationNolint(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{nolint: "revive,unused"}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface3NolintOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface3NolintOutput)
+	}
+
+	// Without comments, the directive stands alone.
+	fns, err = funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err = g.genStubs("r *Receiver", fns[:1], nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if want := "//nolint:revive,unused\nfunc (r *Receiver) Method1("; !strings.HasPrefix(string(src), want) {
+		t.Errorf("genStubs without comments=\n%s\nwant prefix\n%s", src, want)
+	}
+}
+
+func TestStubGenerationRewriteComments(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface33", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{nameComments: true}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface33RewriteOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface33RewriteOutput)
+	}
+}
+
+func TestNameComment(t *testing.T) {
+	cases := []struct {
+		comment string
+		want    string
+	}{
+		{comment: "// Get returns the value.\n", want: "// Get returns the value.\n"},
+		{comment: "// Returns the value.\n", want: "// Get returns the value.\n"},
+		{comment: "// get returns the value.\n", want: "// Get returns the value.\n"},
+		{comment: "// GET: the value.\n", want: "// Get: the value.\n"},
+		{comment: "// HTTP getter.\n", want: "// Get HTTP getter.\n"},
+		{comment: "// Returns the value,\n// or nil.\n", want: "// Get returns the value,\n// or nil.\n"},
+		{comment: "//go:noinline\n", want: "//go:noinline\n"},
+		{comment: "/* Returns the value. */\n", want: "/* Returns the value. */\n"},
+		{comment: "", want: ""},
+	}
+	for _, tt := range cases {
+		if got := nameComment(tt.comment, "Get"); got != tt.want {
+			t.Errorf("nameComment(%q)=%q want %q", tt.comment, got, tt.want)
+		}
+	}
+}
+
+func TestStubGenerationMaxLine(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{maxLine: 64}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface3MaxLineOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface3MaxLineOutput)
+	}
+}
+
+func TestStubGenerationCommentPrefix(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  string
+	}{
+		{
+			iface: "github.com/josharian/impl/testdata.Interface1",
+			want:  strings.ReplaceAll(testdata.Interface1Output, "// Method", "// [impl] Method"),
+		},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface2",
+			want:  strings.ReplaceAll(testdata.Interface2Output, "/*\nMethod", "/*\n[impl] Method"),
+		},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, ".", "", WithComments)
+		if err != nil {
+			t.Fatalf("funcs(%q).err=%v", tt.iface, err)
+		}
+		g := &generator{commentPrefix: "[impl] "}
+		src, err := g.genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs.err=%v", err)
+		}
+		if string(src) != tt.want {
+			t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, tt.want)
+		}
+	}
+}
+
+func TestStubGenerationZeroBody(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface11", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{body: zeroMode, returns: map[string]string{"bool": "true"}}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface11ZeroOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface11ZeroOutput)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	ctors, err := constructors("testdata")
+	if err != nil {
+		t.Fatalf("constructors.err=%v", err)
+	}
+	want := map[string]string{"Struct5": "NewStruct5()", "*Struct5": "NewStruct5Ptr()"}
+	if !reflect.DeepEqual(ctors, want) {
+		t.Errorf("constructors=%v, want %v", ctors, want)
+	}
+
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface11", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{body: zeroMode, returns: ctors}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if want := "return NewStruct5(), nil, false // TODO: Implement"; !strings.Contains(string(src), want) {
+		t.Errorf("genStubs output missing %q:\n%s", want, src)
+	}
+}
+
+func TestStubGenerationErrReturnBody(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface11", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{body: errReturnMode}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface11ErrReturnOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface11ErrReturnOutput)
+	}
+}
+
+func TestStubGenerationCtxCheck(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface11", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{ctxCheck: true}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface11CtxCheckOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface11CtxCheckOutput)
+	}
+
+	fns, err = funcs("github.com/josharian/impl/testdata.Interface36", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err = g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface36CtxCheckOutput {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, testdata.Interface36CtxCheckOutput)
+	}
+}
+
+func TestGenTests(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface11", ".", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err := genTests("testdata", []string{"r *Implemented"}, fns, "testdata")
+	if err != nil {
+		t.Fatalf("genTests.err=%v", err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatalf("genTests output does not parse: %v\n%s", err, src)
+	}
+	var imported, tests []string
+	for _, imp := range f.Imports {
+		imported = append(imported, imp.Path.Value)
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			tests = append(tests, fn.Name.Name)
+		}
+	}
+	if want := []string{`"context"`, `"reflect"`, `"testing"`}; !reflect.DeepEqual(imported, want) {
+		t.Errorf("genTests imports %q, want %q", imported, want)
+	}
+	if want := []string{"TestImplemented_Method1", "TestImplemented_Method2", "TestImplemented_Method3", "TestImplemented_Method4"}; !reflect.DeepEqual(tests, want) {
+		t.Errorf("genTests declares %q, want %q", tests, want)
+	}
+	for _, want := range []string{
+		"got, err := r.Method1(tt.args.ctx, tt.args.arg1)",
+		"got, got1, got2 := r.Method3(tt.args.arg1, tt.args.arg2)",
+		"\t\t\tr.Method4()\n",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("genTests output missing %q:\n%s", want, src)
+		}
+	}
+
+	if _, err := genTests("testdata", []string{"r *ImplementedGeneric[T]"}, fns, "testdata"); err == nil {
+		t.Errorf("genTests accepted a generic receiver")
+	}
+}
+
+func BenchmarkFuncsEmbedded(b *testing.B) {
+	// io.ReadWriteCloser embeds three interfaces from its own package,
+	// each of which is resolved separately.
+	for i := 0; i < b.N; i++ {
+		if _, err := funcs("io.ReadWriteCloser", ".", "", WithComments); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindInterfaceStdlib(b *testing.B) {
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := findInterface("io.Reader", "."); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// goimports is how io.Reader was resolved before the fast path,
+	// and how ambiguous names still are.
+	b.Run("goimports", func(b *testing.B) {
+		src := []byte("package hack\nvar i io.Reader")
+		for i := 0; i < b.N; i++ {
+			if _, err := imports.Process("__go_impl__.go", src, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStubGenerationNoFormat(t *testing.T) {
+	// An invalid type makes the generated code unformattable.
+	fns := []Func{{Name: "Broken", Params: []Param{{Name: "x", Type: "]["}}}}
+	g := &generator{noFormat: true}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	want := "func (r *Receiver) Broken(x ][, )(){\n" + panicBody + "\n}\n\n"
+	if string(src) != want {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%q\nwant\n%q\n", fns, src, want)
+	}
+
+	// Without -no-format, the unformatted stubs come with the error.
+	src, err = genStubs("r *Receiver", fns, nil)
+	if err == nil {
+		t.Error("genStubs of unformattable stubs: want error, got nil")
+	}
+	if string(src) != want {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%q\nwant\n%q\n", fns, src, want)
+	}
+}
+
+func TestIndentWithSpaces(t *testing.T) {
+	src := "func (r *Receiver) Method() string {\n" +
+		"\tif true {\n" +
+		"\t\treturn `raw\n" +
+		"\tkept\n" +
+		"`\n" +
+		"\t}\n" +
+		"\treturn \"\\t\"\n" +
+		"}\n"
+	want := "func (r *Receiver) Method() string {\n" +
+		"  if true {\n" +
+		"    return `raw\n" +
+		"\tkept\n" +
+		"`\n" +
+		"  }\n" +
+		"  return \"\\t\"\n" +
+		"}\n"
+	if got := string(indentWithSpaces([]byte(src), 2)); got != want {
+		t.Errorf("indentWithSpaces(%q, 2)=\n%q\nwant\n%q", src, got, want)
+	}
+}
+
+func TestBuildConstraintLine(t *testing.T) {
+	cases := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "linux", want: "//go:build linux"},
+		{expr: "linux&&(amd64 ||arm64)", want: "//go:build linux && (amd64 || arm64)"},
+		{expr: "!windows", want: "//go:build !windows"},
+		{expr: "linux &&", wantErr: true},
+		{expr: "linux darwin", wantErr: true},
+		{expr: "", wantErr: true},
+	}
+	for _, tt := range cases {
+		got, err := buildConstraintLine(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("buildConstraintLine(%q).err=%v want %s", tt.expr, err, errBool(tt.wantErr))
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("buildConstraintLine(%q)=%q want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedHeader(t *testing.T) {
+	got := generatedHeader([]string{"-header", "r *Receiver", "io.Reader"})
+	want := "// Code generated by \"impl -header 'r *Receiver' io.Reader\"; DO NOT EDIT.\n\n"
+	if got != want {
+		t.Errorf("generatedHeader=%q want %q", got, want)
+	}
+	// See 'go help generate'.
+	generated := regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+	if line, _, _ := strings.Cut(got, "\n"); !generated.MatchString(line) {
+		t.Errorf("generatedHeader=%q does not match %v", got, generated)
+	}
+}
+
+func TestFuncsAt(t *testing.T) {
+	const filename = "testdata/interfaces.go"
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point into the middle of Interface1's second method.
+	before, _, ok := strings.Cut(string(src), "Method2(arg1 int, arg2 int)")
+	if !ok {
+		t.Fatalf("Interface1.Method2 not found in %s", filename)
+	}
+	line := strings.Count(before, "\n") + 1
+	col := len(before) - strings.LastIndex(before, "\n") + 3
+
+	cases := []struct {
+		pos     string
+		want    string
+		wantErr bool
+	}{
+		{pos: fmt.Sprintf("%s:%d:%d", filename, line, col), want: testdata.Interface1Output},
+		{pos: filename + ":1:1", wantErr: true},
+		{pos: filename + ":1", wantErr: true},
+		{pos: filename + ":100000:1", wantErr: true},
+	}
+	for _, tt := range cases {
+		r := &resolver{comments: WithComments}
+		fns, err := r.funcsAt(tt.pos)
+		gotErr := err != nil
+		if tt.wantErr != gotErr {
+			t.Errorf("funcsAt(%q).err=%v want %s", tt.pos, err, errBool(tt.wantErr))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		src, err := genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs.err=%v", err)
+		}
+		if string(src) != tt.want {
+			t.Errorf("funcsAt(%q) stubs=\n%s\nwant\n%s\n", tt.pos, src, tt.want)
+		}
+	}
+}
+
+func TestColumnOffset(t *testing.T) {
+	// "é" is 2 bytes, 1 rune and 1 UTF-16 unit; "𝔾" is 4 bytes, 1 rune and 2 UTF-16 units.
+	line := []byte("\tvar é, 𝔾 io.Reader")
+	cases := []struct {
+		col      int
+		encoding string
+		want     int
+		wantErr  bool
+	}{
+		{col: 1, encoding: byteCols, want: 0},
+		{col: 15, encoding: byteCols, want: 14},
+		{col: 11, encoding: runeCols, want: 14},
+		{col: 12, encoding: utf16Cols, want: 14},
+		{col: 15, encoding: "", want: 14},
+		{col: 100, encoding: byteCols, wantErr: true},
+		{col: 100, encoding: runeCols, wantErr: true},
+		{col: 1, encoding: "utf32", wantErr: true},
+	}
+	for _, tt := range cases {
+		got, err := columnOffset(line, tt.col, tt.encoding)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("columnOffset(%q, %d, %q).err=%v want %s", line, tt.col, tt.encoding, err, errBool(tt.wantErr))
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("columnOffset(%q, %d, %q)=%d want %d", line, tt.col, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestFuncsAtReference(t *testing.T) {
+	const filename = "testdata/interfaces.go"
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _, ok := strings.Cut(string(src), "func ReferencesInterfaces(")
+	if !ok {
+		t.Fatalf("ReferencesInterfaces not found in %s", filename)
+	}
+	line := strings.Count(before, "\n") + 1
+	decl := string(src)[len(before):]
+	decl, _, _ = strings.Cut(decl, "\n")
+
+	cases := []struct {
+		name string // text at the position
+		want []string
+	}{
+		{name: "Reader", want: []string{"Read"}},
+		{name: "io.Reader", want: []string{"Read"}},
+		{name: "Interface1", want: []string{"Method1", "Method2", "Method3"}},
+		{name: "GenericInterface1", want: []string{"Method1", "Method2", "Method3"}},
+	}
+	for _, tt := range cases {
+		pos := fmt.Sprintf("%s:%d:%d", filename, line, strings.Index(decl, tt.name)+1)
+		r := &resolver{comments: WithoutComments}
+		fns, err := r.funcsAt(pos)
+		if err != nil {
+			t.Errorf("funcsAt(%q).err=%v", pos, err)
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, fn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcsAt(%q) at %s=%q want %q", pos, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStubGenerationCtxFirst(t *testing.T) {
+	fns := []Func{{
+		Name:   "Get",
+		Params: []Param{{Name: "key", Type: "string"}, {Name: "ctx", Type: "context.Context"}},
+		Res:    []Param{{Type: "error"}},
+	}}
+	cases := []struct {
+		g    *generator
+		want string
+	}{
+		{
+			g: &generator{ctxFirst: true},
+			want: "func (r *Receiver) Get(ctx context.Context, key string) error {\n" +
+				"\t" + panicBody + "\n}\n\n",
+		},
+		{
+			// Delegated calls keep the interface's parameter order.
+			g: &generator{ctxFirst: true, delegate: "inner"},
+			want: "func (r *Receiver) Get(ctx context.Context, key string) error {\n" +
+				"\treturn r.inner.Get(key, ctx)\n}\n\n",
+		},
+	}
+	for _, tt := range cases {
+		src, err := tt.g.genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs.err=%v", err)
+		}
+		if string(src) != tt.want {
+			t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, tt.want)
+		}
+	}
+}
+
+func TestStubGenerationTypeNames(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "testdata", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{typeNames: true}
+	src, err := g.genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Errorf("genStubs.err=%v", err)
+	}
+	want := "func (r *Receiver) Method1(s string, s2 string) (s3 string, err error) {\n" +
+		"\t" + panicBody + "\n}\n\n" +
+		"func (r *Receiver) Method2(i int, arg2 int) (i2 int, err error) {\n" +
+		"\t" + panicBody + "\n}\n\n" +
+		"func (r *Receiver) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool) {\n" +
+		"\t" + panicBody + "\n}\n\n"
+	if string(src) != want {
+		t.Errorf("genStubs(\"r *Receiver\", %+#v).src=\n%s\nwant\n%s\n", fns, src, want)
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	cases := []struct {
+		typ  string
+		want string
+	}{
+		{typ: "string", want: "s"},
+		{typ: "error", want: "err"},
+		{typ: "*http.Request", want: "r"},
+		{typ: "[]byte", want: "b"},
+		{typ: "...interface{}", want: "i"},
+		{typ: "map[string]int", want: "m"},
+		{typ: "func() error", want: "f"},
+		{typ: "chan int", want: "ch"},
+		{typ: "List[int]", want: "l"},
+	}
+	for _, tt := range cases {
+		if got := typeName(tt.typ); got != tt.want {
+			t.Errorf("typeName(%q)=%q want %q", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestFuncSignature(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "testdata", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := []string{
+		"Method1(_ string, _ string) (string, error)",
+		"Method2(_ int, arg2 int) (_ int, err error)",
+		"Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool)",
+	}
+	for i, fn := range fns {
+		if got := funcSignature(fn); got != want[i] {
+			t.Errorf("funcSignature(%s)=%q want %q", fn.Name, got, want[i])
+		}
+	}
+	if got, want := funcSignature(Func{Name: "Close", Res: []Param{{Type: "error"}}}), "Close() error"; got != want {
+		t.Errorf("funcSignature(Close)=%q want %q", got, want)
+	}
+	if got, want := typeSignature(fns[1]), "Method2(int, int) (int, error)"; got != want {
+		t.Errorf("typeSignature(Method2)=%q want %q", got, want)
+	}
+}
+
+func TestNameReceiver(t *testing.T) {
+	cases := []struct {
+		recv string
+		want string
+	}{
+		{recv: "*Server", want: "s *Server"},
+		{recv: "Server", want: "s Server"},
+		{recv: "*Repo[K, V]", want: "r *Repo[K, V]"},
+		{recv: "x *Server", want: "x *Server"},
+		{recv: " *Server ", want: "s *Server"},
+	}
+	for _, tt := range cases {
+		if got := nameReceiver(tt.recv); got != tt.want {
+			t.Errorf("nameReceiver(%q)=%q want %q", tt.recv, got, tt.want)
+		}
+	}
+}
+
+func TestSignatureMismatches(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  []string
+	}{
+		{iface: "github.com/josharian/impl/testdata.Interface3"},
+		{
+			iface: "github.com/josharian/impl/testdata.Interface13",
+			want:  []string{"Implemented has method Method1(string, string) (string, error), but the interface requires Method1(string) error"},
+		},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, ".", "testdata", WithComments)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			continue
+		}
+		got, err := signatureMismatches(fns, "r *Implemented", "testdata")
+		if err != nil {
+			t.Errorf("signatureMismatches(%q).err=%v", tt.iface, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("signatureMismatches(%q)=%q want %q", tt.iface, got, tt.want)
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	abs, err := filepath.Abs(filepath.Join("testdata", "overlay.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := fmt.Sprintf("%s\n%d\n%s", abs, len(overlaySrc), overlaySrc)
+	files, err := readOverlay(strings.NewReader(archive))
+	if err != nil {
+		t.Fatalf("readOverlay.err=%v", err)
+	}
+	overlay = files
+	defer func() { overlay = nil }()
+
+	fns, err := funcs("OverlayInterface[string]", "testdata", "testdata", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	if len(fns) != 1 || fns[0].Name != "Get" || len(fns[0].Res) != 1 || fns[0].Res[0].Type != "string" {
+		t.Fatalf("funcs=%+v, want Get() string", fns)
+	}
+	implemented, err := implementedFuncs(fns, "r *Implemented", "testdata")
+	if err != nil {
+		t.Fatalf("implementedFuncs.err=%v", err)
+	}
+	if !implemented["Get"] {
+		t.Errorf("implementedFuncs=%v, want Get from the overlay", implemented)
+	}
+}
+
+const overlaySrc = `package testdata
+
+type OverlayInterface[T any] interface {
+	Get() T
+}
+
+func (r *Implemented) Get() string { return "" }
+`
+
+func TestInterfaceLiteral(t *testing.T) {
+	cases := []struct {
+		iface string
+		want  []string
+	}{
+		{iface: "interface{ Foo(); Bar() int }", want: []string{"Foo()", "Bar() int"}},
+		{iface: "interface{ Put(Struct5) error }", want: []string{"Put(Struct5) error"}},
+		{iface: "interface{ io.Closer; Reset(r io.Reader) }", want: []string{"Close() error", "Reset(io.Reader)"}},
+		{iface: "interface{ Interface3; Foo() }", want: []string{"Method1(string, string) (string, error)", "Method2(int, int) (int, error)", "Method3(bool, bool) (bool, bool)", "Foo()"}},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, "testdata", "testdata", WithoutComments)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, typeSignature(fn))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q)=%q want %q", tt.iface, got, tt.want)
+		}
+	}
+
+	if _, err := funcs("interface{}", "testdata", "testdata", WithoutComments); !errors.Is(err, ErrEmptyInterface) {
+		t.Errorf("funcs(interface{}).err=%v want %v", err, ErrEmptyInterface)
+	}
+	// The parser's error locates the mistake in the literal.
+	if _, err := funcs("interface{ Read(p []byte error }", "testdata", "testdata", WithoutComments); err == nil || !strings.Contains(err.Error(), "missing ','") {
+		t.Errorf("funcs(interface{ Read(p []byte error }).err=%v want the parser's error", err)
+	}
+}
+
+func TestGoimportsStubs(t *testing.T) {
+	fns, err := funcs("io.ReaderFrom", ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	g := &generator{body: errReturnMode}
+	src, err := g.genStubs("r *R", fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	got, err := goimportsStubs(src, "testdata")
+	if err != nil {
+		t.Fatalf("goimportsStubs.err=%v", err)
+	}
+	want := `import (
+	"errors"
+	"io"
+)
+
+func (r *R) ReadFrom(_ io.Reader) (n int64, err error) {
+	return 0, errors.New("not implemented") // TODO: Implement
+}
+
+`
+	if string(got) != want {
+		t.Errorf("goimportsStubs=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCrossFileEmbedding(t *testing.T) {
+	var loaded int
+	r := &resolver{srcDir: ".", comments: WithComments}
+	r.logf = func(format string, args ...interface{}) {
+		if strings.HasPrefix(format, "loaded package") {
+			loaded++
+		}
+	}
+	fns, err := r.funcs("github.com/josharian/impl/testdata.Interface28")
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err := genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	if string(src) != testdata.Interface28Output {
+		t.Errorf("got\n%s\nwant\n%s", src, testdata.Interface28Output)
+	}
+	// Interface9, in another file, is found in the package already loaded.
+	if loaded != 1 {
+		t.Errorf("loaded the package %d times, want 1", loaded)
+	}
+}
+
+func TestFuncsOf(t *testing.T) {
+	r := &resolver{srcDir: ".", comments: WithoutComments}
+	fns, err := r.funcsOf([]string{"io.ReadCloser", "io.Reader", "io.Writer"}, false)
+	if err != nil {
+		t.Fatalf("funcsOf.err=%v", err)
+	}
+	var got []string
+	for _, fn := range fns {
+		got = append(got, fn.Name)
+	}
+	if want := []string{"Read", "Close", "Write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("funcsOf=%q want %q", got, want)
+	}
+
+	ifaces := []string{"io.Reader", "io.NoSuchInterface", "io.Writer"}
+	if _, err := r.funcsOf(ifaces, false); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("funcsOf(%q, false).err=%v want %v", ifaces, err, ErrInterfaceNotFound)
+	}
+	fns, err = r.funcsOf(ifaces, true)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 interfaces failed to resolve") || !strings.Contains(err.Error(), "io.NoSuchInterface") {
+		t.Errorf("funcsOf(%q, true).err=%v want a report of io.NoSuchInterface", ifaces, err)
+	}
+	got = nil
+	for _, fn := range fns {
+		got = append(got, fn.Name)
+	}
+	if want := []string{"Read", "Write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("funcsOf(%q, true)=%q want %q", ifaces, got, want)
+	}
+
+	// No method can satisfy both.
+	ifaces = []string{"io.Reader", "interface{ Read(p []byte) error }"}
+	for _, keepGoing := range []bool{false, true} {
+		_, err := r.funcsOf(ifaces, keepGoing)
+		want := "conflicting signatures for method Read: io.Reader requires Read([]byte) (int, error), but interface{ Read(p []byte) error } requires Read([]byte) error"
+		if err == nil || err.Error() != want {
+			t.Errorf("funcsOf(%q, %t).err=%v want %q", ifaces, keepGoing, err, want)
+		}
+	}
+}
+
+func TestGenericCompositeTypes(t *testing.T) {
+	cases := []struct {
+		recv  string
+		iface string
+		want  string
+	}{
+		{
+			recv:  "r *Cache[K, V]",
+			iface: "github.com/josharian/impl/testdata.GenericInterface8[K, V]",
+			want:  testdata.GenericInterface8Output,
+		},
+		{
+			recv:  "r *Receiver",
+			iface: "github.com/josharian/impl/testdata.GenericInterface8[string, []byte]",
+			want:  testdata.GenericInterface8ConcreteOutput,
+		},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, ".", "", WithComments)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			continue
+		}
+		src, err := genStubs(tt.recv, fns, nil)
+		if err != nil {
+			t.Errorf("genStubs(%q).err=%v", tt.recv, err)
+			continue
+		}
+		if string(src) != tt.want {
+			t.Errorf("genStubs(%q, %q)=\n%s\nwant\n%s", tt.recv, tt.iface, src, tt.want)
+		}
+	}
+}
+
+func TestResultNames(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface3", ".", "testdata", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	cases := []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: keepResults,
+			want: []string{
+				"Method1(_ string, _ string) (string, error)",
+				"Method2(_ int, arg2 int) (_ int, err error)",
+				"Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool)",
+			},
+		},
+		{
+			mode: noneResults,
+			want: []string{
+				"Method1(_ string, _ string) (string, error)",
+				"Method2(_ int, arg2 int) (int, error)",
+				"Method3(arg1 bool, arg2 bool) (bool, bool)",
+			},
+		},
+		{
+			mode: autoResults,
+			want: []string{
+				"Method1(_ string, _ string) (s string, err error)",
+				"Method2(_ int, arg2 int) (i int, err error)",
+				"Method3(arg1 bool, arg2 bool) (b bool, b2 bool)",
+			},
+		},
+	}
+	for _, tt := range cases {
+		g := &generator{resultNames: tt.mode}
+		src, err := g.genStubs("r *Implemented", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs(%s).err=%v", tt.mode, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(src), "func (r *Implemented) "+want+" {") {
+				t.Errorf("genStubs(%s) missing %s:\n%s", tt.mode, want, src)
+			}
+		}
+	}
+}
+
+func TestResultStruct(t *testing.T) {
+	fns := []Func{
+		{Name: "Get", Params: []Param{{Name: "key", Type: "K"}}, Res: []Param{{Type: "V"}, {Name: "ok", Type: "bool"}, {Type: "error"}}},
+		{Name: "Len", Res: []Param{{Type: "int"}}},
+	}
+	cases := []struct {
+		body string
+		want string
+	}{
+		{
+			body: panicMode,
+			want: `// RepoGetResults holds the results of Get.
+type RepoGetResults[K any, V any] struct {
+	V  V
+	Ok bool
+	Err error
+}
+
+func (r *Repo[K, V]) Get(key K) RepoGetResults[K, V] {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Repo[K, V]) Len() int {
+	panic("not implemented") // TODO: Implement
+}
+`,
+		},
+		{
+			body: errReturnMode,
+			want: `// RepoGetResults holds the results of Get.
+type RepoGetResults[K any, V any] struct {
+	V   V
+	Ok  bool
+	Err error
+}
+
+func (r *Repo[K, V]) Get(key K) RepoGetResults[K, V] {
+	return RepoGetResults[K, V]{Err: errors.New("not implemented")} // TODO: Implement
+}
+
+func (r *Repo[K, V]) Len() int {
+	return 0 // TODO: Implement
+}
+`,
+		},
+	}
+	for _, tt := range cases {
+		g := &generator{body: tt.body, resultStruct: 2}
+		src, err := g.genStubs("r *Repo[K, V]", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs(%s).err=%v", tt.body, err)
+			continue
+		}
+		want, err := format.Source([]byte(tt.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(src)) != strings.TrimSpace(string(want)) {
+			t.Errorf("genStubs(%s):\n%s\nwant:\n%s", tt.body, src, want)
+		}
+	}
+}
+
+func TestEmbedIface(t *testing.T) {
+	r := &resolver{srcDir: "testdata", recvPkg: "testdata"}
+	for iface, want := range map[string]string{
+		"io.ReadCloser": "io.ReadCloser",
+		"Interface3":    "Interface3",
+		"github.com/josharian/impl/testdata.GenericInterface8[K, V]": "GenericInterface8[K, V]",
+		"github.com/josharian/impl/testdata/nested.Interface24":      "nested.Interface24",
+		"error": "error",
+	} {
+		got, err := r.ifaceType(iface)
+		if err != nil {
+			t.Errorf("ifaceType(%q).err=%v", iface, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ifaceType(%q)=%q want %q", iface, got, want)
+		}
+	}
+
+	got, err := embedIfaceType("r *Cache[K, V]", []string{"GenericInterface8[K, V]", "io.Closer"})
+	if err != nil {
+		t.Fatalf("embedIfaceType.err=%v", err)
+	}
+	want := `// Cache embeds GenericInterface8[K, V] and io.Closer for the methods it does not override.
+type Cache[K any, V any] struct {
+	GenericInterface8[K, V]
+	io.Closer
+}
+
+`
+	if string(got) != want {
+		t.Errorf("embedIfaceType=\n%s\nwant\n%s", got, want)
+	}
+
+	fns := []Func{{Name: "Read"}, {Name: "Close"}, {Name: "Write"}}
+	overridden, err := overriddenFuncs(fns, []string{"Write", " Read"})
+	if err != nil {
+		t.Fatalf("overriddenFuncs.err=%v", err)
+	}
+	if want := []Func{{Name: "Read"}, {Name: "Write"}}; !reflect.DeepEqual(overridden, want) {
+		t.Errorf("overriddenFuncs=%v want %v", overridden, want)
+	}
+	if _, err := overriddenFuncs(fns, []string{"Read", "Seek"}); err == nil || !strings.Contains(err.Error(), "Seek") {
+		t.Errorf("overriddenFuncs(Seek).err=%v want an error naming Seek", err)
+	}
+}
+
+func TestShadowedNames(t *testing.T) {
+	fns, err := funcs("github.com/josharian/impl/testdata.Interface30", ".", "", WithComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	cases := []struct {
+		body string
+		want string
+	}{
+		{body: panicMode, want: testdata.Interface30Output},
+		{body: errReturnMode, want: testdata.Interface30ErrReturnOutput},
+	}
+	for _, tt := range cases {
+		g := &generator{body: tt.body}
+		src, err := g.genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs(%s).err=%v", tt.body, err)
+			continue
+		}
+		if string(src) != tt.want {
+			t.Errorf("genStubs(%s)=\n%s\nwant\n%s", tt.body, src, tt.want)
+		}
+	}
+
+	// The stubs must compile.
+	for _, g := range []*generator{{}, {body: zeroMode}, {delegate: "next"}} {
+		src, err := g.genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Fatalf("genStubs.err=%v", err)
+		}
+		file := "package p\n\ntype Receiver struct{ next interface {\n" +
+			"Swap(old, new string)\nFail(panic string)\nMake(nil, false int) (bool, error)\n" +
+			"String() string\nJoin(errors []error) error\n} }\n\n" + string(src)
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "p.go", file, 0)
+		if err != nil {
+			t.Fatalf("ParseFile.err=%v\n%s", err, file)
+		}
+		if _, err := new(types.Config).Check("p", fset, []*ast.File{f}, nil); err != nil {
+			t.Errorf("generated stubs don't compile: %v\n%s", err, src)
+		}
+	}
+
+	// Keywords are not valid names.
+	fns = []Func{{Name: "M", Params: []Param{{Name: "type", Type: "string"}}}}
+	src, err := genStubs("r *Receiver", fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	if want := "func (r *Receiver) M(_ string) {"; !strings.Contains(string(src), want) {
+		t.Errorf("genStubs missing %q:\n%s", want, src)
+	}
+}
+
+func TestMultiplePackages(t *testing.T) {
+	dir := filepath.Join("testdata", "multipkg")
+	_, err := funcs("Store", dir, "", WithoutComments)
+	if err == nil || !strings.Contains(err.Error(), "multipkg and main; use -pkgname") {
+		t.Errorf("funcs(Store).err=%v want a -pkgname hint", err)
+	}
+
+	cases := []struct {
+		pkgName string
+		tests   bool
+		iface   string
+		want    []string
+	}{
+		{pkgName: "multipkg", iface: "Store", want: []string{"Get"}},
+		{pkgName: "multipkg", tests: true, iface: "Fake", want: []string{"Get", "Reset"}},
+		{pkgName: "main", iface: "Runner", want: []string{"Run"}},
+	}
+	for _, tt := range cases {
+		r := &resolver{srcDir: dir, pkgName: tt.pkgName, tests: tt.tests}
+		fns, err := r.funcs(tt.iface)
+		if err != nil {
+			t.Errorf("funcs(%q) with -pkgname %s: err=%v", tt.iface, tt.pkgName, err)
+			continue
+		}
+		var got []string
+		for _, fn := range fns {
+			got = append(got, fn.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("funcs(%q) with -pkgname %s=%q want %q", tt.iface, tt.pkgName, got, tt.want)
+		}
+	}
+}
+
+func TestWrapRegion(t *testing.T) {
+	fns, err := funcs("io.Closer", ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err := genStubs("r *R", fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	got := wrapRegion(src)
+	want := `// impl:begin
+
+func (r *R) Close() error {
+	panic("not implemented") // TODO: Implement
+}
+
+// impl:end
+`
+	if string(got) != want {
+		t.Errorf("wrapRegion=\n%s\nwant\n%s", got, want)
+	}
+	// The region is stable under gofmt, and the marker isn't a doc comment.
+	formatted, err := format.Source(append([]byte("package p\n\n"), got...))
+	if err != nil {
+		t.Fatalf("format.Source.err=%v", err)
+	}
+	if want := "package p\n\n" + want; string(formatted) != want {
+		t.Errorf("gofmt changed the region:\n%s\nwant\n%s", formatted, want)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", formatted, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile.err=%v", err)
+	}
+	if doc := f.Decls[0].(*ast.FuncDecl).Doc; doc != nil {
+		t.Errorf("Close has doc comment %q, want none", doc.Text())
+	}
+}
+
+func TestOutputPackage(t *testing.T) {
+	cases := []struct {
+		desc        string
+		outPkg      string
+		recvPkg     string
+		declPkg     string
+		want        string
+		wantWarning bool
+		wantStubs   string
+	}{
+		{
+			desc:      "declared receiver",
+			declPkg:   "testdata",
+			want:      "testdata",
+			wantStubs: testdata.Interface5Output,
+		},
+		{
+			desc:      "declared receiver with a matching -recvpkg",
+			recvPkg:   "testdata",
+			declPkg:   "testdata",
+			want:      "testdata",
+			wantStubs: testdata.Interface5Output,
+		},
+		{
+			desc:        "declared receiver with a misremembered -recvpkg",
+			recvPkg:     "test",
+			declPkg:     "testdata",
+			want:        "testdata",
+			wantWarning: true,
+			wantStubs:   testdata.Interface5Output,
+		},
+		{
+			desc:      "-outpkg overrides the receiver's package and -recvpkg",
+			outPkg:    "test",
+			recvPkg:   "testdata",
+			declPkg:   "testdata",
+			want:      "test",
+			wantStubs: testdata.Interface6Output,
+		},
+		{
+			desc:      "undeclared receiver",
+			recvPkg:   "test",
+			want:      "test",
+			wantStubs: testdata.Interface6Output,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, warning := outputPackage(tt.outPkg, tt.recvPkg, tt.declPkg)
+			if got != tt.want || (warning != "") != tt.wantWarning {
+				t.Errorf("outputPackage(%q, %q, %q)=%q, %q want %q, warning %v", tt.outPkg, tt.recvPkg, tt.declPkg, got, warning, tt.want, tt.wantWarning)
+			}
+			fns, err := funcs("github.com/josharian/impl/testdata.Interface5", ".", got, WithComments)
+			if err != nil {
+				t.Fatalf("funcs.err=%v", err)
+			}
+			src, err := genStubs("r *Implemented", fns, nil)
+			if err != nil {
+				t.Fatalf("genStubs.err=%v", err)
+			}
+			if string(src) != tt.wantStubs {
+				t.Errorf("genStubs=\n%s\nwant\n%s", src, tt.wantStubs)
+			}
+		})
+	}
+}
+
+func TestVendoredInterface(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":             "module example.com/app\n\ngo 1.18\n\nrequire github.com/foo/bar v1.0.0\n",
+		"sub/sub.go":         "package sub\n",
+		"vendor/modules.txt": "# github.com/foo/bar v1.0.0\n## explicit\ngithub.com/foo/bar\n",
+		"vendor/github.com/foo/bar/bar.go": `package bar
+
+// Iface is declared only in the vendor directory.
+type Iface interface {
+	// Vendored is the first method of Iface.
+	Vendored() Value
+}
+
+// Value is returned by Iface.
+type Value struct{}
+`,
+	}
+	for name, src := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// setModFlag changes GOFLAGS, which t.Setenv restores.
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOPROXY", "off")
+	iface, dir := "github.com/foo/bar.Iface", filepath.Join(root, "sub")
+
+	// Module mode ignores the vendor directory,
+	// and the module cache lacks the dependency.
+	if err := setModFlag("mod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := funcs(iface, dir, "sub", WithoutComments); err == nil {
+		t.Fatalf("funcs with -mod=mod: want error, got nil")
+	}
+
+	// The interface resolves in the module of -dir, not of the
+	// current directory, which has no such dependency.
+	if err := setModFlag("vendor"); err != nil {
+		t.Fatal(err)
+	}
+	fns, err := funcs(iface, dir, "sub", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	want := []Func{{Name: "Vendored", Res: []Param{{Type: "bar.Value"}}}}
+	if !reflect.DeepEqual(fns, want) {
+		t.Errorf("funcs=%+v want %+v", fns, want)
+	}
+}
+
+func TestSelfReferentialInterface(t *testing.T) {
+	cases := []struct {
+		iface   string
+		recvPkg string
+		want    string
+	}{
+		{
+			iface:   "github.com/josharian/impl/testdata.GenericInterface9[*Struct5]",
+			recvPkg: "testdata",
+			want:    testdata.GenericInterface9Output,
+		},
+		{
+			iface:   "github.com/josharian/impl/testdata.GenericInterface9[map[string]int]",
+			recvPkg: "other",
+			want:    testdata.GenericInterface9OtherPkgOutput,
+		},
+	}
+	for _, tt := range cases {
+		fns, err := funcs(tt.iface, ".", tt.recvPkg, WithComments)
+		if err != nil {
+			t.Errorf("funcs(%q).err=%v", tt.iface, err)
+			continue
+		}
+		src, err := genStubs("r *Receiver", fns, nil)
+		if err != nil {
+			t.Errorf("genStubs.err=%v", err)
+			continue
+		}
+		if string(src) != tt.want {
+			t.Errorf("genStubs(%q) in package %s=\n%s\nwant\n%s", tt.iface, tt.recvPkg, src, tt.want)
+		}
+	}
+}
+
+func TestStubsFromTypes(t *testing.T) {
+	const src = `package p
+
+type Value struct{}
+
+type Store interface {
+	Put(key string, vals ...Value) error
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("example.com/p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := pkg.Scope().Lookup("Store").Type().Underlying().(*types.Interface)
+
+	// In the interface's own package, types are unqualified.
+	out, err := genStubs("r *R", methods.FromInterface(iface, types.RelativeTo(pkg)), nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v\n%s", err, out)
+	}
+	if want := "func (r *R) Put(key string, vals ...Value) error {"; !strings.Contains(string(out), want) {
+		t.Errorf("genStubs missing %q:\n%s", want, out)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"Receiver":   "receiver",
+		"MyType":     "my_type",
+		"HTTPServer": "http_server",
+		"ServeHTTP":  "serve_http",
+		"Base64Enc":  "base64_enc",
+		"myType":     "my_type",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q)=%q want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my-store")
+	if err := os.Mkdir(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if got := newFilePackage(dir, ""); got != "mystore" {
+		t.Errorf("newFilePackage(empty dir)=%q want mystore", got)
+	}
+	if got := newFilePackage(dir, "store"); got != "store" {
+		t.Errorf("newFilePackage(empty dir, store)=%q want store", got)
+	}
+	if got := newFilePackage("testdata", "store"); got != "testdata" {
+		t.Errorf("newFilePackage(testdata, store)=%q want testdata", got)
+	}
+
+	fns, err := funcs("io.ReadCloser", ".", "", WithoutComments)
+	if err != nil {
+		t.Fatalf("funcs.err=%v", err)
+	}
+	src, err := (&generator{body: errReturnMode}).genStubs("r *FileStore", fns, nil)
+	if err != nil {
+		t.Fatalf("genStubs.err=%v", err)
+	}
+	filename := filepath.Join(dir, snakeCase("FileStore")+".go")
+	got, err := newFile(filename, "store", "//go:build linux\n\n", src)
+	if err != nil {
+		t.Fatalf("newFile.err=%v", err)
+	}
+	want := `//go:build linux
+
+package store
+
+import "errors"
+
+func (r *FileStore) Read(p []byte) (n int, err error) {
+	return 0, errors.New("not implemented") // TODO: Implement
+}
+
+func (r *FileStore) Close() error {
+	return errors.New("not implemented") // TODO: Implement
+}
+`
+	if string(got) != want {
+		t.Errorf("newFile=\n%s\nwant\n%s", got, want)
+	}
+
+	var preview bytes.Buffer
+	if err := previewNewFile(&preview, filename, got); err != nil {
+		t.Fatalf("previewNewFile.err=%v", err)
+	}
+	if want := "--- dry run: would write " + filename + " ---\n" + want; preview.String() != want {
+		t.Errorf("previewNewFile=\n%s\nwant\n%s", preview.String(), want)
+	}
+	if _, err := os.Stat(filename); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("previewNewFile wrote %s", filename)
+	}
+
+	if err := writeNewFile(filename, got); err != nil {
+		t.Fatalf("writeNewFile.err=%v", err)
+	}
+	if err := previewNewFile(io.Discard, filename, got); !errors.Is(err, os.ErrExist) {
+		t.Errorf("previewNewFile(existing).err=%v want %v", err, os.ErrExist)
+	}
+	if err := writeNewFile(filename, got); !errors.Is(err, os.ErrExist) {
+		t.Errorf("writeNewFile(existing).err=%v want %v", err, os.ErrExist)
+	}
+}
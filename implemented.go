@@ -4,23 +4,104 @@ import (
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // implementedFuncs returns list of Func which already implemented.
 func implementedFuncs(fns []Func, recv string, srcDir string) (map[string]bool, error) {
+	methods, _, err := receiverMethods(recv, srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	implemented := make(map[string]bool)
+	for _, fn := range fns {
+		if _, ok := methods[fn.Name]; ok {
+			implemented[fn.Name] = true
+		}
+	}
+	return implemented, nil
+}
+
+// signatureMismatches returns a description of each method of recv
+// that has the name of one of fns but a different signature.
+// Types are compared as written, so a type spelled differently in
+// the receiver's package (for example, via an import alias) is
+// reported as a mismatch.
+func signatureMismatches(fns []Func, recv string, srcDir string) ([]string, error) {
+	methods, fset, err := receiverMethods(recv, srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	for _, fn := range fns {
+		decl, ok := methods[fn.Name]
+		if !ok {
+			continue
+		}
+		have := funcSignature(Func{Name: fn.Name, Params: fieldTypes(fset, decl.Type.Params), Res: fieldTypes(fset, decl.Type.Results)})
+		if sig := typeSignature(fn); sig != have {
+			mismatches = append(mismatches, fmt.Sprintf("%s has method %s, but the interface requires %s", getReceiverType(recv), have, sig))
+		}
+	}
+	return mismatches, nil
+}
+
+// fieldTypes returns the type of each param in fields, without its
+// name, repeating the type of grouped params.
+func fieldTypes(fset *token.FileSet, fields *ast.FieldList) []Param {
+	if fields == nil {
+		return nil
+	}
+	var params []Param
+	for _, field := range fields.List {
+		var buf strings.Builder
+		printer.Fprint(&buf, fset, field.Type)
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, Param{Type: buf.String()})
+		}
+	}
+	return params
+}
+
+// typeSignature formats the signature of fn as funcSignature does,
+// but from its param and result types alone, such as
+// "Read([]byte) (int, error)", so that names don't affect comparisons.
+func typeSignature(fn Func) string {
+	unnamed := func(ps []Param) []Param {
+		var types []Param
+		for _, p := range ps {
+			types = append(types, Param{Type: p.Type})
+		}
+		return types
+	}
+	return funcSignature(Func{Name: fn.Name, Params: unnamed(fn.Params), Res: unnamed(fn.Res)})
+}
+
+// receiverMethods returns the methods declared in srcDir
+// on the type of receiver recv, keyed by name.
+func receiverMethods(recv string, srcDir string) (map[string]*ast.FuncDecl, *token.FileSet, error) {
 
 	// determine name of receiver type
 	recvType := getReceiverType(recv)
 
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, srcDir, nil, 0)
+	pkgs, err := parseDir(fset, srcDir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	implemented := make(map[string]bool)
+	methods := make(map[string]*ast.FuncDecl)
 
 	// getReceiver returns title of struct to which belongs the method
 	getReceiver := func(mf *ast.FuncDecl) string {
@@ -51,12 +132,6 @@ func implementedFuncs(fns []Func, recv string, srcDir string) (map[string]bool,
 		return ""
 	}
 
-	// Convert fns to a map, to prevent accidental quadratic behavior.
-	want := make(map[string]bool)
-	for _, fn := range fns {
-		want[fn.Name] = true
-	}
-
 	// finder is a walker func which will be called for each element in the source code of package
 	// but we are interested in funcs only with receiver same to typeTitle
 	finder := func(n ast.Node) bool {
@@ -67,20 +142,86 @@ func implementedFuncs(fns []Func, recv string, srcDir string) (map[string]bool,
 		if getReceiver(x) != recvType {
 			return true
 		}
-		name := x.Name.String()
-		if want[name] {
-			implemented[name] = true
-		}
+		methods[x.Name.String()] = x
 		return true
 	}
 
+	// A directory may hold more than one package, such as an external
+	// test package, so only look at the one that declares the receiver
+	// type, if any does. Sorting tries a package before its _test package.
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if pkg := pkgs[name]; packageDeclaresType(pkg, recvType) {
+			pkgs = map[string]*ast.Package{name: pkg}
+			break
+		}
+	}
+
 	for _, pkg := range pkgs {
 		for _, f := range pkg.Files {
 			ast.Inspect(f, finder)
 		}
 	}
 
-	return implemented, nil
+	return methods, fset, nil
+}
+
+// parseDir is like parser.ParseDir, but reads files from the overlay
+// when it has them, including files that exist only there.
+func parseDir(fset *token.FileSet, dir string) (map[string]*ast.Package, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+			names = append(names, e.Name())
+		}
+	}
+	names = append(names, overlayFiles(dir, names)...)
+
+	pkgs := make(map[string]*ast.Package)
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		src, err := readSource(filename)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok := pkgs[f.Name.Name]
+		if !ok {
+			pkg = &ast.Package{Name: f.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[f.Name.Name] = pkg
+		}
+		pkg.Files[filename] = f
+	}
+	return pkgs, nil
+}
+
+// packageDeclaresType reports whether pkg declares a top-level type named name.
+func packageDeclaresType(pkg *ast.Package, name string) bool {
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				if spec.(*ast.TypeSpec).Name.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 // getReceiverType returns type name of receiver or fatal if receiver is invalid.
@@ -0,0 +1,57 @@
+// Package methods describes the method signatures that impl generates
+// stubs for, so that other tools can build them from their own
+// type-checked interfaces.
+package methods
+
+import "go/types"
+
+// Func represents a function signature.
+type Func struct {
+	Name     string
+	Params   []Param
+	Res      []Param
+	Comments string
+}
+
+// Param represents a parameter in a function or method signature.
+type Param struct {
+	Name string
+	Type string
+}
+
+// FromInterface returns the methods of the type-checked interface
+// iface, including those of the interfaces it embeds, in the order of
+// iface.Method, which sorts them by name. Types are written using
+// qualifier, such as one from types.RelativeTo for the receiver's
+// package.
+//
+// Params and results keep their declared names, so unnamed ones are
+// left unnamed. The resulting Funcs have no comments.
+func FromInterface(iface *types.Interface, qualifier types.Qualifier) []Func {
+	var fns []Func
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		sig := m.Type().(*types.Signature)
+		fns = append(fns, Func{
+			Name:   m.Name(),
+			Params: tupleParams(sig.Params(), sig.Variadic(), qualifier),
+			Res:    tupleParams(sig.Results(), false, qualifier),
+		})
+	}
+	return fns
+}
+
+// tupleParams converts the params or results in t to Params.
+// If variadic is set, the last one is variadic.
+func tupleParams(t *types.Tuple, variadic bool, qualifier types.Qualifier) []Param {
+	var params []Param
+	for i := 0; i < t.Len(); i++ {
+		v := t.At(i)
+		typ := types.TypeString(v.Type(), qualifier)
+		if variadic && i == t.Len()-1 {
+			typ = "..." + types.TypeString(v.Type().(*types.Slice).Elem(), qualifier)
+		}
+		params = append(params, Param{Name: v.Name(), Type: typ})
+	}
+	return params
+}
@@ -0,0 +1,55 @@
+package methods
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestFromInterface(t *testing.T) {
+	const src = `package p
+
+type Value struct{}
+
+type Closer interface {
+	Close() error
+}
+
+type Store interface {
+	Closer
+	Put(key string, vals ...Value) error
+	Get(string) (Value, bool)
+	Watch(fn func(Value)) (stop func())
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("example.com/p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := pkg.Scope().Lookup("Store").Type().Underlying().(*types.Interface)
+
+	want := []Func{
+		{Name: "Close", Res: []Param{{Type: "error"}}},
+		{Name: "Get", Params: []Param{{Type: "string"}}, Res: []Param{{Type: "p.Value"}, {Type: "bool"}}},
+		{Name: "Put", Params: []Param{{Name: "key", Type: "string"}, {Name: "vals", Type: "...p.Value"}}, Res: []Param{{Type: "error"}}},
+		{Name: "Watch", Params: []Param{{Name: "fn", Type: "func(p.Value)"}}, Res: []Param{{Name: "stop", Type: "func()"}}},
+	}
+	fns := FromInterface(iface, (*types.Package).Name)
+	if !reflect.DeepEqual(fns, want) {
+		t.Errorf("FromInterface=\n%+v\nwant\n%+v", fns, want)
+	}
+
+	// In the interface's own package, types are unqualified.
+	fns = FromInterface(iface, types.RelativeTo(pkg))
+	if got := fns[1].Res[0].Type; got != "Value" {
+		t.Errorf("FromInterface relative to p: Get returns %q, want Value", got)
+	}
+}
@@ -0,0 +1,16 @@
+// Package ambiguous imports two packages that declare interfaces of
+// the same name, used to test resolving unqualified interface names
+// through the imports of the receiver's package.
+package ambiguous
+
+import (
+	"net/http"
+
+	"github.com/josharian/impl/testdata/ambiguous/handlers"
+)
+
+// Server is a dummy type that refers to both Handler interfaces.
+type Server struct {
+	HTTP  http.Handler
+	Other handlers.Handler
+}
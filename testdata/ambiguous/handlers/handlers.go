@@ -0,0 +1,8 @@
+// Package handlers declares a Handler interface, like net/http.
+package handlers
+
+// Handler is a dummy interface whose name is also declared by net/http.
+type Handler interface {
+	// Handle is the method of Handler.
+	Handle()
+}
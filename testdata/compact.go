@@ -0,0 +1,60 @@
+package testdata
+
+// The interfaces in this file are deliberately not gofmt-formatted,
+// to test interfaces whose methods share a line.
+
+// Interface22 is a dummy interface to test the program output. This
+// interface tests methods declared on one line.
+type Interface22 interface { Method1(); Method2() int }
+
+// Interface22Output is the expected output generated from reflecting on
+// Interface22, provided that the receiver is equal to 'r *Receiver'.
+var Interface22Output = `func (r *Receiver) Method1() {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method2() int {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface23 is a dummy interface to test the program output. This
+// interface tests comments around methods that share a line. Only
+// Method1 has a doc comment; the others must not pick up comments
+// that merely share their line.
+type Interface23 interface {
+	// Method1 is the first method of Interface23.
+	Method1(); Method2() int // Method2 trails Method1.
+	/* Method3 is inline. */ Method3(); Method4() // Method4 trails Method3.
+	Method5() /* Method5 is inline. */; Method6()
+}
+
+// Interface23Output is the expected output generated from reflecting on
+// Interface23, provided that the receiver is equal to 'r *Receiver'.
+var Interface23Output = `// Method1 is the first method of Interface23.
+func (r *Receiver) Method1() {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method2() int {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method3() {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method4() {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method5() {
+	panic("not implemented") // TODO: Implement
+}
+
+func (r *Receiver) Method6() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
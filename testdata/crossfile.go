@@ -0,0 +1,25 @@
+package testdata
+
+// Interface28Output is the expected output generated from reflecting on
+// Interface28, provided that the receiver is equal to 'r *Receiver'.
+var Interface28Output = `// Method1 is the first method of Interface1.
+// line two
+func (r *Receiver) Method1(arg1 string, arg2 string) (result string, err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method5 is the method declared by Interface28 itself.
+func (r *Receiver) Method5() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface28 is a dummy interface to test the program output. This
+// interface tests embedding of an interface declared in another file
+// of the same package, free_floating.go.
+type Interface28 interface {
+	Interface9
+	// Method5 is the method declared by Interface28 itself.
+	Method5()
+}
@@ -0,0 +1,20 @@
+package testdata
+
+import . "io"
+
+// DotImportInterface is a dummy interface to test the program output. This
+// interface tests qualification of types brought into scope by a dot import.
+type DotImportInterface interface {
+	// Method1 is the first method of DotImportInterface.
+	Method1(src Reader) (Writer, error)
+}
+
+// DotImportInterfaceOutput is the expected output generated from reflecting
+// on DotImportInterface, provided that the receiver is equal to
+// 'r *Receiver'.
+var DotImportInterfaceOutput = `// Method1 is the first method of DotImportInterface.
+func (r *Receiver) Method1(src io.Reader) (io.Writer, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
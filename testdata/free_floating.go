@@ -22,4 +22,52 @@ type Interface9 interface {
 	// free-floating comment after Method1
 }
 
+// Interface29Output is the expected output generated from reflecting on
+// Interface29, provided that the receiver is equal to 'r *Receiver'.
+var Interface29Output = `// Method1 keeps only this second paragraph, which is adjacent to it.
+// line two
+func (r *Receiver) Method1() {
+	panic("not implemented") // TODO: Implement
+}
+
+/*
+Method2 keeps only this second block comment.
+*/
+func (r *Receiver) Method2() {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 keeps both paragraphs of a doc comment
+//
+// that an empty comment line joins.
+func (r *Receiver) Method3() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface29 is a dummy interface to test the program output.
+// This interface tests doc comments split by a blank line into two
+// comment groups, of which only the one adjacent to the method is
+// its doc.
+type Interface29 interface {
+	// A heading, separated from the doc of Method1 by a blank line.
+
+	// Method1 keeps only this second paragraph, which is adjacent to it.
+	// line two
+	Method1()
+
+	/* A block comment separated from the doc of Method2. */
+
+	/*
+		Method2 keeps only this second block comment.
+	*/
+	Method2()
+
+	// Method3 keeps both paragraphs of a doc comment
+	//
+	// that an empty comment line joins.
+	Method3()
+}
+
 // free-floating comment at end of file. This must be the last comment in this file.
@@ -0,0 +1,6 @@
+// Package http shares its name with net/http, used to test qualifying
+// types from packages named like the receiver's package.
+package http
+
+// Receiver is a dummy type whose package is named http.
+type Receiver struct{}
@@ -1,5 +1,13 @@
 package testdata
 
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/josharian/impl/testdata/yaml.v2"
+)
+
 // Interface1 is a dummy interface to test the program output.
 // This interface tests //-style method comments.
 type Interface1 interface {
@@ -84,6 +92,32 @@ type GenericInterface3[Type1, Type2 any] interface {
 	Method3(Type1) Type2
 }
 
+// GenericInterface4 is a dummy interface to test the program output. This
+// interface tests substitution of type parameters nested within func types.
+type GenericInterface4[Type any] interface {
+	// Callback is the first method of GenericInterface4.
+	Callback() func(Type) error
+}
+
+// GenericInterface5 is a dummy interface to test the program output. This
+// interface tests generation of generic interfaces whose type parameters
+// are constrained by an interface other than any.
+type GenericInterface5[Err error] interface {
+	// Wrap is the first method of GenericInterface5.
+	Wrap(error) Err
+	// Unwrap is the second method of GenericInterface5.
+	Unwrap(Err) []Err
+}
+
+// GenericInterface6 is a dummy interface to test the program output. This
+// interface tests generation of generic interfaces that embed generic
+// interfaces instantiated with their own type parameters.
+type GenericInterface6[Type any] interface {
+	GenericInterface1[Type]
+	// Extra is the method of GenericInterface6.
+	Extra() []Type
+}
+
 // Interface1Output is the expected output generated from reflecting on
 // Interface1, provided that the receiver is equal to 'r *Receiver'.
 var Interface1Output = `// Method1 is the first method of Interface1.
@@ -106,21 +140,21 @@ func (r *Receiver) Method3(arg1 bool, arg2 bool) (result bool, err error) {
 // Interface2Output is the expected output generated from reflecting on
 // Interface2, provided that the receiver is equal to 'r *Receiver'.
 var Interface2Output = `/*
-	Method1 is the first method of Interface2.
+Method1 is the first method of Interface2.
 */
 func (r *Receiver) Method1(arg1 int64, arg2 int64) (result int64, err error) {
 	panic("not implemented") // TODO: Implement
 }
 
 /*
-	Method2 is the second method of Interface2.
+Method2 is the second method of Interface2.
 */
 func (r *Receiver) Method2(arg1 float64, arg2 float64) (result float64, err error) {
 	panic("not implemented") // TODO: Implement
 }
 
 /*
-	Method3 is the third method of Interface2.
+Method3 is the third method of Interface2.
 */
 func (r *Receiver) Method3(arg1 interface{}, arg2 interface{}) (result interface{}, err error) {
 	panic("not implemented") // TODO: Implement
@@ -170,6 +204,28 @@ func (r *Implemented) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool)
 type Struct5 struct {
 }
 
+// NewStruct5 is a dummy constructor to test the use of constructors
+// for results.
+func NewStruct5() Struct5 {
+	return Struct5{}
+}
+
+// NewStruct5Ptr is a dummy constructor of *Struct5, which is a
+// different result type from Struct5.
+func NewStruct5Ptr() *Struct5 {
+	return &Struct5{}
+}
+
+// NewError returns a predeclared type, so it isn't a constructor.
+func NewError() error {
+	return nil
+}
+
+// NewStruct5WithName takes arguments, so it isn't a constructor.
+func NewStruct5WithName(name string) Struct5 {
+	return Struct5{}
+}
+
 type Interface5 interface {
 	// Method is the first method of Interface5.
 	Method2(arg1 string, arg2 Interface2, arg3 Struct5) (Interface3, error)
@@ -269,6 +325,31 @@ func (r *Receiver) Method3(_ string) bool {
 
 `
 
+// GenericInterface4Output is the expected output generated from reflecting on
+// GenericInterface4, provided that the receiver is equal to 'r *Receiver' and
+// it was generated with the type parameters [string].
+var GenericInterface4Output = `// Callback is the first method of GenericInterface4.
+func (r *Receiver) Callback() func(string) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface5Output is the expected output generated from reflecting on
+// GenericInterface5, provided that the receiver is equal to 'r *Receiver' and
+// it was generated with the type parameters [*os.PathError].
+var GenericInterface5Output = `// Wrap is the first method of GenericInterface5.
+func (r *Receiver) Wrap(_ error) *os.PathError {
+	panic("not implemented") // TODO: Implement
+}
+
+// Unwrap is the second method of GenericInterface5.
+func (r *Receiver) Unwrap(_ *os.PathError) []*os.PathError {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
 type ImplementedGeneric[Type1 any] struct{}
 
 func (r *ImplementedGeneric[Type1]) Method1(arg1 string, arg2 string) (result string, err error) {
@@ -334,3 +415,898 @@ func (r *ImplementedGenericMultipleParams[Type1, Type2]) Method2(arg1 string, ar
 }
 
 `
+
+// Interface10 is a dummy interface to test the program output. This
+// interface tests reflowing of long method comments.
+type Interface10 interface {
+	// Method1 is the first method of Interface10 and its comment is deliberately long enough to need wrapping.
+	Method1(arg1 string) error
+}
+
+// Interface10Output is the expected output generated from reflecting on
+// Interface10, provided that the receiver is equal to 'r *Receiver' and
+// comments are wrapped at 60 columns.
+var Interface10Output = `// Method1 is the first method of Interface10 and its
+// comment is deliberately long enough to need wrapping.
+func (r *Receiver) Method1(arg1 string) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface3DelegateOutput is the expected output generated from reflecting
+// on Interface3, plus a variadic Printf method, provided that the receiver is
+// equal to 'r *Receiver' and calls are delegated to the field inner.
+var Interface3DelegateOutput = `// Method1 is the first method of Interface3.
+func (r *Receiver) Method1(arg0 string, arg1 string) (string, error) {
+	return r.inner.Method1(arg0, arg1)
+}
+
+// Method2 is the second method of Interface3.
+func (r *Receiver) Method2(arg0 int, arg2 int) (_ int, err error) {
+	return r.inner.Method2(arg0, arg2)
+}
+
+// Method3 is the third method of Interface3.
+func (r *Receiver) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool) {
+	return r.inner.Method3(arg1, arg2)
+}
+
+func (r *Receiver) Printf(arg0 string, args ...interface{}) {
+	r.inner.Printf(arg0, args...)
+}
+
+`
+
+// Interface3BlankUnusedOutput is the expected output generated from
+// reflecting on Interface3, provided that the receiver is equal to
+// 'r *Receiver' and params are assigned to the blank identifier.
+var Interface3BlankUnusedOutput = `// Method1 is the first method of Interface3.
+func (r *Receiver) Method1(_ string, _ string) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface3.
+func (r *Receiver) Method2(_ int, arg2 int) (_ int, err error) {
+	_ = arg2
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of Interface3.
+func (r *Receiver) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool) {
+	_ = arg1
+	_ = arg2
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface3NolintOutput is the expected output generated from reflecting
+// on Interface3, provided that the receiver is equal to 'r *Receiver' and
+// each method is marked with a //nolint:revive,unused directive.
+var Interface3NolintOutput = `// Method1 is the first method of Interface3.
+//
+//nolint:revive,unused
+func (r *Receiver) Method1(_ string, _ string) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface3.
+//
+//nolint:revive,unused
+func (r *Receiver) Method2(_ int, arg2 int) (_ int, err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of Interface3.
+//
+//nolint:revive,unused
+func (r *Receiver) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface3MaxLineOutput is the expected output generated from reflecting
+// on Interface3, provided that the receiver is equal to 'r *Receiver' and
+// signatures longer than 64 columns are wrapped.
+var Interface3MaxLineOutput = `// Method1 is the first method of Interface3.
+func (r *Receiver) Method1(_ string, _ string) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface3.
+func (r *Receiver) Method2(_ int, arg2 int) (_ int, err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of Interface3.
+func (r *Receiver) Method3(
+	arg1 bool,
+	arg2 bool,
+) (result1 bool, result2 bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface3WrapOutput is the expected output generated from reflecting on
+// Interface3 plus a variadic Printf method, provided that the receiver is
+// equal to '*Receiver' and the wrapped field is "inner".
+var Interface3WrapOutput = `// Method1 is the first method of Interface3.
+func (r *Receiver) Method1(arg0 string, arg1 string) (string, error) {
+	res0, res1 := r.inner.Method1(arg0, arg1)
+	r.record("Method1", []interface{}{arg0, arg1}, []interface{}{res0, res1})
+	return res0, res1
+}
+
+// Method2 is the second method of Interface3.
+func (r *Receiver) Method2(arg0 int, arg2 int) (_ int, err error) {
+	res0, res1 := r.inner.Method2(arg0, arg2)
+	r.record("Method2", []interface{}{arg0, arg2}, []interface{}{res0, res1})
+	return res0, res1
+}
+
+// Method3 is the third method of Interface3.
+func (r *Receiver) Method3(arg1 bool, arg2 bool) (result1 bool, result2 bool) {
+	res0, res1 := r.inner.Method3(arg1, arg2)
+	r.record("Method3", []interface{}{arg1, arg2}, []interface{}{res0, res1})
+	return res0, res1
+}
+
+func (r *Receiver) Printf(arg0 string, args ...interface{}) {
+	r.inner.Printf(arg0, args...)
+	r.record("Printf", []interface{}{arg0, args}, nil)
+}
+
+`
+
+// Interface11 is a dummy interface to test the program output. This
+// interface tests generation of method bodies that return values.
+type Interface11 interface {
+	// Method1 is the first method of Interface11.
+	Method1(ctx context.Context, arg1 string) (int, error)
+	// Method2 is the second method of Interface11.
+	Method2(context.Context) error
+	// Method3 is the third method of Interface11.
+	Method3(arg1 *Struct5, arg2 []byte) (Struct5, map[string]bool, bool)
+	// Method4 is the fourth method of Interface11.
+	Method4()
+}
+
+// Interface11ZeroOutput is the expected output generated from reflecting on
+// Interface11, provided that the receiver is equal to 'r *Receiver', the body
+// mode is zero, and bool results return true.
+var Interface11ZeroOutput = `// Method1 is the first method of Interface11.
+func (r *Receiver) Method1(ctx context.Context, arg1 string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, nil // TODO: Implement
+}
+
+// Method2 is the second method of Interface11.
+func (r *Receiver) Method2(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil // TODO: Implement
+}
+
+// Method3 is the third method of Interface11.
+func (r *Receiver) Method3(arg1 *Struct5, arg2 []byte) (Struct5, map[string]bool, bool) {
+	return *new(Struct5), nil, true // TODO: Implement
+}
+
+// Method4 is the fourth method of Interface11.
+func (r *Receiver) Method4() {
+	// TODO: Implement
+}
+
+`
+
+// Interface11ErrReturnOutput is the expected output generated from
+// reflecting on Interface11, provided that the receiver is equal to
+// 'r *Receiver' and the body mode is errreturn.
+var Interface11ErrReturnOutput = `// Method1 is the first method of Interface11.
+func (r *Receiver) Method1(ctx context.Context, arg1 string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface11.
+func (r *Receiver) Method2(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of Interface11.
+func (r *Receiver) Method3(arg1 *Struct5, arg2 []byte) (Struct5, map[string]bool, bool) {
+	return *new(Struct5), nil, false // TODO: Implement
+}
+
+// Method4 is the fourth method of Interface11.
+func (r *Receiver) Method4() {
+	// TODO: Implement
+}
+
+`
+
+// Interface11CtxCheckOutput is the expected output generated from
+// reflecting on Interface11, provided that the receiver is equal to
+// 'r *Receiver' and context checks are enabled.
+var Interface11CtxCheckOutput = `// Method1 is the first method of Interface11.
+func (r *Receiver) Method1(ctx context.Context, arg1 string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface11.
+func (r *Receiver) Method2(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of Interface11.
+func (r *Receiver) Method3(arg1 *Struct5, arg2 []byte) (Struct5, map[string]bool, bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method4 is the fourth method of Interface11.
+func (r *Receiver) Method4() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface12 is a dummy interface to test the program output. This
+// interface tests embedding of a generic interface instantiated with
+// concrete types.
+type Interface12 interface {
+	GenericInterface1[int]
+	// Extra is the method declared by Interface12 itself.
+	Extra()
+}
+
+// Interface12Output is the expected output generated from reflecting on
+// Interface12, provided that the receiver is equal to 'r *Receiver'.
+var Interface12Output = `// Method1 is the first method of GenericInterface1.
+func (r *Receiver) Method1() int {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of GenericInterface1.
+func (r *Receiver) Method2(_ int) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of GenericInterface1.
+func (r *Receiver) Method3(_ int) int {
+	panic("not implemented") // TODO: Implement
+}
+
+// Extra is the method declared by Interface12 itself.
+func (r *Receiver) Extra() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface13 is a dummy interface to test the program output. Its
+// Method1 conflicts with the Method1 that Implemented already has.
+type Interface13 interface {
+	// Method1 has the name of Implemented.Method1 but a different signature.
+	Method1(string) error
+	// Method2 is not implemented yet.
+	Method2()
+}
+
+// Interface14 is a dummy interface to test the program output. This
+// interface tests constraint interfaces, whose type-set elements
+// contribute no methods.
+type Interface14 interface {
+	~int | ~string
+	// String is the method of Interface14.
+	String() string
+}
+
+// Interface14Output is the expected output generated from reflecting on
+// Interface14, provided that the receiver is equal to 'r *Receiver'.
+var Interface14Output = `// String is the method of Interface14.
+func (r *Receiver) String() string {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// ReferencesInterfaces refers to interfaces outside of interface
+// declarations, to test locating an interface by the position of its name.
+func ReferencesInterfaces(_ io.Reader, _ Interface1, _ GenericInterface1[string]) {}
+
+// Interface15 is a dummy interface to test the program output. This
+// interface tests embedding of empty interfaces, which contribute no
+// methods.
+type Interface15 interface {
+	any
+	interface{}
+	EmptyInterface
+	// Method1 is the first method of Interface15.
+	Method1()
+	interface {
+		// Method2 is the second method of Interface15.
+		Method2()
+	}
+}
+
+// Interface15Output is the expected output generated from reflecting on
+// Interface15, provided that the receiver is equal to 'r *Receiver'.
+var Interface15Output = `// Method1 is the first method of Interface15.
+func (r *Receiver) Method1() {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of Interface15.
+func (r *Receiver) Method2() {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface16 is a dummy interface to test the program output. This
+// interface tests unexported methods, which only types in this package
+// can implement.
+type Interface16 interface {
+	// Method1 is the exported method of Interface16.
+	Method1()
+	// method2 is the unexported method of Interface16.
+	method2()
+}
+
+// EmptyInterface is a dummy interface with no methods, which impl
+// rejects, but which other interfaces may embed.
+type EmptyInterface interface{}
+
+// Interface17 is a dummy interface to test the program output. This
+// interface tests embedding of a sibling interface by its bare name.
+type Interface17 interface {
+	Interface3
+	// Method4 is the method declared by Interface17 itself.
+	Method4()
+}
+
+// Interface18 is a dummy interface to test the program output. This
+// interface tests results of func and struct types, whose param and
+// field names must not be qualified.
+type Interface18 interface {
+	// Handler returns a func with named params and results.
+	Handler() func(w http.ResponseWriter, R *http.Request) (N int, Err error)
+	// Struct returns a struct with an exported field.
+	Struct() struct{ Name Struct5 }
+}
+
+// Interface18Output is the expected output generated from reflecting on
+// Interface18, provided that the receiver is equal to 'r *Receiver'.
+var Interface18Output = `// Handler returns a func with named params and results.
+func (r *Receiver) Handler() func(w http.ResponseWriter, R *http.Request) (N int, Err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Struct returns a struct with an exported field.
+func (r *Receiver) Struct() struct{ Name testdata.Struct5 } {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Number is a dummy non-interface type used as a type-set element.
+type Number int
+
+// Interface19 is a dummy interface to test the program output. This
+// interface tests constraint interfaces whose type-set elements are
+// named, predeclared and composite types.
+type Interface19 interface {
+	Number | int | []byte | *Struct5
+	comparable
+	// Method1 is the method of Interface19.
+	Method1()
+}
+
+// Interface20 is a dummy interface to test the program output. This
+// interface tests single-term type-set elements of a constraint.
+type Interface20 interface {
+	Number
+	~int
+	// Method1 is the method of Interface20.
+	Method1()
+}
+
+// Interface21 is a dummy interface to test the program output. This
+// interface tests single-term composite type-set elements.
+type Interface21 interface {
+	[]byte
+	// Method1 is the method of Interface21.
+	Method1()
+}
+
+// Interface31 is a dummy interface to test the program output. This
+// interface tests embedding a struct type, which impl reports as an
+// error rather than as a type-set element.
+type Interface31 interface {
+	Struct5
+	// Method1 is the method of Interface31.
+	Method1()
+}
+
+// Interface32 is a dummy interface to test the program output. This
+// interface tests embedding an interface that embeds a struct type.
+type Interface32 interface {
+	Interface31
+}
+
+// Interface33 is a dummy interface to test the program output. This
+// interface tests doc comments that don't begin with the method name.
+type Interface33 interface {
+	// Returns the value stored under key.
+	Get(key string) string
+	// put stores value under key.
+	Put(key, value string)
+	// URL of the store.
+	Endpoint() string
+	// Len reports the number of values.
+	Len() int
+	// Deprecated: Use Len.
+	Size() int
+	/* Closes the store. */
+	Close() error
+}
+
+// Interface33RewriteOutput is the expected output generated from
+// reflecting on Interface33 with -rewrite-comments, provided that the
+// receiver is equal to 'r *Receiver'.
+var Interface33RewriteOutput = `// Get returns the value stored under key.
+func (r *Receiver) Get(key string) string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Put stores value under key.
+func (r *Receiver) Put(key string, value string) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Endpoint URL of the store.
+func (r *Receiver) Endpoint() string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Len reports the number of values.
+func (r *Receiver) Len() int {
+	panic("not implemented") // TODO: Implement
+}
+
+// Deprecated: Use Len.
+func (r *Receiver) Size() int {
+	panic("not implemented") // TODO: Implement
+}
+
+/* Closes the store. */
+func (r *Receiver) Close() error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface34 is a dummy interface to test the program output. This
+// interface tests embedding a non-interface type outside a constraint.
+type Interface34 interface {
+	Number
+	// Method1 is the method of Interface34.
+	Method1()
+}
+
+// Interface35 is a dummy interface to test the program output. This
+// interface tests embedding a predeclared type outside a constraint.
+type Interface35 interface {
+	int
+	// Method1 is the method of Interface35.
+	Method1()
+}
+
+// Interface36 is a dummy interface to test the program output. This
+// interface tests context checks in methods that return no error.
+type Interface36 interface {
+	// Len is the first method of Interface36.
+	Len(ctx context.Context) int
+	// Do is the second method of Interface36.
+	Do(context.Context) error
+}
+
+// Interface36CtxCheckOutput is the expected output generated from
+// reflecting on Interface36, provided that the receiver is equal to
+// 'r *Receiver' and context checks are enabled.
+var Interface36CtxCheckOutput = `// Len is the first method of Interface36.
+func (r *Receiver) Len(ctx context.Context) int {
+	_ = ctx
+	panic("not implemented") // TODO: Implement
+}
+
+// Do is the second method of Interface36.
+func (r *Receiver) Do(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface6Output is the expected output generated from reflecting on
+// GenericInterface6, provided that the receiver is equal to 'r *Receiver' and
+// it was generated with the type parameters [string].
+var GenericInterface6Output = `// Method1 is the first method of GenericInterface1.
+func (r *Receiver) Method1() string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method2 is the second method of GenericInterface1.
+func (r *Receiver) Method2(_ string) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Method3 is the third method of GenericInterface1.
+func (r *Receiver) Method3(_ string) string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Extra is the method of GenericInterface6.
+func (r *Receiver) Extra() []string {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface25 is a dummy interface to test the program output. This
+// interface tests doc comments on embedded interfaces.
+type Interface25 interface {
+	// Reader reads the input.
+	io.Reader
+	// Interface5 is embedded from this package.
+	Interface5
+}
+
+// Interface25Output is the expected output generated from reflecting on
+// Interface25, provided that the receiver is equal to 'r *Receiver'.
+var Interface25Output = `// Reader reads the input.
+func (r *Receiver) Read(p []byte) (n int, err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Interface5 is embedded from this package.
+// Method is the first method of Interface5.
+func (r *Receiver) Method2(arg1 string, arg2 testdata.Interface2, arg3 testdata.Struct5) (testdata.Interface3, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Concrete is a dummy type to test the program output. This type tests
+// generation of stubs for the exported methods of a concrete type.
+type Concrete[Type any] struct{}
+
+// Get is the first method of Concrete.
+func (c *Concrete[T]) Get() T {
+	var zero T
+	return zero
+}
+
+// Set is the second method of Concrete.
+func (c Concrete[Type]) Set(Type, Struct5) {}
+
+func (c *Concrete[Type]) reset() {}
+
+// ConcreteOutput is the expected output generated from reflecting on
+// Concrete, provided that the receiver is equal to 'r *Receiver' and
+// it was generated with the type parameters [string].
+var ConcreteOutput = `// Get is the first method of Concrete.
+func (r *Receiver) Get() string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Set is the second method of Concrete.
+func (r *Receiver) Set(_ string, _ Struct5) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// YAMLUnmarshalerOutput is the expected output generated from reflecting on
+// yaml.Unmarshaler, declared in directory yaml.v2, provided that the
+// receiver is equal to 'r *Receiver'.
+var YAMLUnmarshalerOutput = `// UnmarshalYAML is the first method of Unmarshaler.
+func (r *Receiver) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Decode is the second method of Unmarshaler.
+func (r *Receiver) Decode(n *yaml.Node) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface26 is a dummy interface to test the program output. This
+// interface tests embedding of, and references to, a package whose
+// directory name differs from its package name.
+type Interface26 interface {
+	yaml.Unmarshaler
+	// Encode is the method of Interface26.
+	Encode(n yaml.Node) ([]byte, error)
+}
+
+// Interface26Output is the expected output generated from reflecting on
+// Interface26, provided that the receiver is equal to 'r *Receiver'.
+var Interface26Output = `// UnmarshalYAML is the first method of Unmarshaler.
+func (r *Receiver) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Decode is the second method of Unmarshaler.
+func (r *Receiver) Decode(n *yaml.Node) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// Encode is the method of Interface26.
+func (r *Receiver) Encode(n yaml.Node) ([]byte, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface7 is a dummy interface to test the program output. This
+// interface tests generic constraint interfaces that mix a type set with
+// methods referring to their type parameter.
+type GenericInterface7[Type any] interface {
+	~int | ~float64
+	// Abs is the first method of GenericInterface7.
+	Abs() Type
+	// Less is the second method of GenericInterface7.
+	Less(Type) bool
+}
+
+// GenericInterface7Output is the expected output generated from reflecting on
+// GenericInterface7, provided that the receiver is equal to 'r *Receiver' and
+// it was generated with the type parameters [float64].
+var GenericInterface7Output = `// Abs is the first method of GenericInterface7.
+func (r *Receiver) Abs() float64 {
+	panic("not implemented") // TODO: Implement
+}
+
+// Less is the second method of GenericInterface7.
+func (r *Receiver) Less(_ float64) bool {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface8 is a dummy interface to test the program output. This
+// interface tests type parameters used within composite types, which
+// must be substituted wherever they appear.
+type GenericInterface8[K comparable, V any] interface {
+	// Get is the first method of GenericInterface8.
+	Get(K) (V, bool)
+	// Range is the second method of GenericInterface8.
+	Range(fn func(K, V) bool)
+	// All is the third method of GenericInterface8.
+	All() map[K]V
+	// Keys is the fourth method of GenericInterface8.
+	Keys() []K
+	// Load is the fifth method of GenericInterface8.
+	Load(ch <-chan map[K][]*V, loader func(K) (V, error)) struct{ Key K }
+}
+
+// GenericInterface8Output is the expected output generated from reflecting on
+// GenericInterface8, provided that the receiver is equal to 'r *Cache[K, V]'
+// and it was generated with the type parameters [K, V].
+var GenericInterface8Output = `// Get is the first method of GenericInterface8.
+func (r *Cache[K, V]) Get(_ K) (V, bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Range is the second method of GenericInterface8.
+func (r *Cache[K, V]) Range(fn func(K, V) bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+// All is the third method of GenericInterface8.
+func (r *Cache[K, V]) All() map[K]V {
+	panic("not implemented") // TODO: Implement
+}
+
+// Keys is the fourth method of GenericInterface8.
+func (r *Cache[K, V]) Keys() []K {
+	panic("not implemented") // TODO: Implement
+}
+
+// Load is the fifth method of GenericInterface8.
+func (r *Cache[K, V]) Load(ch <-chan map[K][]*V, loader func(K) (V, error)) struct{ Key K } {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface8ConcreteOutput is the expected output generated from
+// reflecting on GenericInterface8, provided that the receiver is equal to
+// 'r *Receiver' and it was generated with the type parameters [string, []byte].
+var GenericInterface8ConcreteOutput = `// Get is the first method of GenericInterface8.
+func (r *Receiver) Get(_ string) ([]byte, bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Range is the second method of GenericInterface8.
+func (r *Receiver) Range(fn func(string, []byte) bool) {
+	panic("not implemented") // TODO: Implement
+}
+
+// All is the third method of GenericInterface8.
+func (r *Receiver) All() map[string][]byte {
+	panic("not implemented") // TODO: Implement
+}
+
+// Keys is the fourth method of GenericInterface8.
+func (r *Receiver) Keys() []string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Load is the fifth method of GenericInterface8.
+func (r *Receiver) Load(ch <-chan map[string][]*[]byte, loader func(string) ([]byte, error)) struct{ Key string } {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface30 is a dummy interface to test the program output. This
+// interface tests methods and params named after predeclared
+// identifiers, which stubs must not shadow where they refer to them.
+type Interface30 interface {
+	// String is named after nothing the stub refers to.
+	String() string
+	// Swap has a param named after a builtin that stubs don't use.
+	Swap(old, new string)
+	// Fail has a param that would shadow the panic builtin.
+	Fail(panic string)
+	// Make has params that would shadow the nil and false of zero values.
+	Make(nil, false int) (bool, error)
+	// Join has a param that would shadow the errors package.
+	Join(errors []error) error
+}
+
+// Interface30Output is the expected output generated from reflecting on
+// Interface30, provided that the receiver is equal to 'r *Receiver'.
+var Interface30Output = `// String is named after nothing the stub refers to.
+func (r *Receiver) String() string {
+	panic("not implemented") // TODO: Implement
+}
+
+// Swap has a param named after a builtin that stubs don't use.
+func (r *Receiver) Swap(old string, new string) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Fail has a param that would shadow the panic builtin.
+func (r *Receiver) Fail(_ string) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Make has params that would shadow the nil and false of zero values.
+func (r *Receiver) Make(nil int, false int) (bool, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Join has a param that would shadow the errors package.
+func (r *Receiver) Join(errors []error) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface30ErrReturnOutput is the expected output generated from
+// reflecting on Interface30 with -body=errreturn, provided that the
+// receiver is equal to 'r *Receiver'.
+var Interface30ErrReturnOutput = `// String is named after nothing the stub refers to.
+func (r *Receiver) String() string {
+	return "" // TODO: Implement
+}
+
+// Swap has a param named after a builtin that stubs don't use.
+func (r *Receiver) Swap(old string, new string) {
+	// TODO: Implement
+}
+
+// Fail has a param that would shadow the panic builtin.
+func (r *Receiver) Fail(panic string) {
+	// TODO: Implement
+}
+
+// Make has params that would shadow the nil and false of zero values.
+func (r *Receiver) Make(nil int, _ int) (bool, error) {
+	return false, errors.New("not implemented") // TODO: Implement
+}
+
+// Join has a param that would shadow the errors package.
+func (r *Receiver) Join(_ []error) error {
+	return errors.New("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface9 is a dummy interface to test the program output. This
+// interface tests methods that refer to the interface itself, whose type
+// arguments must be instantiated along with the rest.
+type GenericInterface9[T any] interface {
+	// Clone is the first method of GenericInterface9.
+	Clone() GenericInterface9[T]
+	// Merge is the second method of GenericInterface9.
+	Merge(others ...GenericInterface9[T]) (GenericInterface9[T], error)
+}
+
+// GenericInterface9Output is the expected output generated from reflecting
+// on GenericInterface9, provided that the receiver is equal to 'r *Receiver',
+// in package testdata, and it was generated with the type parameters [*Struct5].
+var GenericInterface9Output = `// Clone is the first method of GenericInterface9.
+func (r *Receiver) Clone() GenericInterface9[*Struct5] {
+	panic("not implemented") // TODO: Implement
+}
+
+// Merge is the second method of GenericInterface9.
+func (r *Receiver) Merge(others ...GenericInterface9[*Struct5]) (GenericInterface9[*Struct5], error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// GenericInterface9OtherPkgOutput is the expected output generated from
+// reflecting on GenericInterface9, provided that the receiver is equal to
+// 'r *Receiver', in another package, and it was generated with the type
+// parameters [map[string]int].
+var GenericInterface9OtherPkgOutput = `// Clone is the first method of GenericInterface9.
+func (r *Receiver) Clone() testdata.GenericInterface9[map[string]int] {
+	panic("not implemented") // TODO: Implement
+}
+
+// Merge is the second method of GenericInterface9.
+func (r *Receiver) Merge(others ...testdata.GenericInterface9[map[string]int]) (testdata.GenericInterface9[map[string]int], error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+// Interface27 is a dummy interface to test the program output. This
+// interface tests grouped and anonymous params and results whose type
+// must be qualified.
+type Interface27 interface {
+	// Grouped is the first method of Interface27.
+	Grouped(a, b Struct5) (x, y, z Struct5)
+	// Anonymous is the second method of Interface27.
+	Anonymous(Struct5, *Struct5) (Struct5, []Struct5, error)
+}
+
+// Interface27Output is the expected output generated from reflecting on
+// Interface27, provided that the receiver is equal to 'r *Receiver'.
+var Interface27Output = `// Grouped is the first method of Interface27.
+func (r *Receiver) Grouped(a testdata.Struct5, b testdata.Struct5) (x testdata.Struct5, y testdata.Struct5, z testdata.Struct5) {
+	panic("not implemented") // TODO: Implement
+}
+
+// Anonymous is the second method of Interface27.
+func (r *Receiver) Anonymous(_ testdata.Struct5, _ *testdata.Struct5) (testdata.Struct5, []testdata.Struct5, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`
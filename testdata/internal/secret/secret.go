@@ -0,0 +1,10 @@
+// Package secret is an internal package of testdata, used to test
+// resolving interfaces in internal packages.
+package secret
+
+// Interface is a dummy interface to test the program output. This
+// interface can only be implemented from within testdata.
+type Interface interface {
+	// Method is the method of Interface.
+	Method() error
+}
@@ -0,0 +1,12 @@
+// Package multipkg shares its directory with a package main, so that
+// the directory has to be disambiguated with -pkgname.
+package multipkg
+
+// Store is a dummy interface declared in the library package.
+type Store interface {
+	// Get is the first method of Store.
+	Get(key string) (Value, error)
+}
+
+// Value is a dummy type returned by Store.
+type Value struct{}
@@ -0,0 +1,11 @@
+package multipkg_test
+
+import "github.com/josharian/impl/testdata/multipkg"
+
+// Fake is a dummy interface declared in the external test package
+// of multipkg.
+type Fake interface {
+	multipkg.Store
+	// Reset is the second method of Fake.
+	Reset()
+}
@@ -0,0 +1,10 @@
+package main
+
+// Runner is a dummy interface declared in the package main
+// beside package multipkg.
+type Runner interface {
+	// Run is the first method of Runner.
+	Run(args []string) int
+}
+
+func main() {}
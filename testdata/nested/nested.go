@@ -0,0 +1,26 @@
+// Package nested is a subdirectory of testdata, used to test resolving
+// unqualified interfaces declared in a parent directory and embedding
+// interfaces from other packages.
+package nested
+
+import "github.com/josharian/impl/testdata"
+
+// Interface12 is a dummy interface to test the program output. This
+// interface tests embedding of a generic interface from another package
+// instantiated with concrete types.
+type Interface12 interface {
+	testdata.GenericInterface1[int]
+	// Extra is the method declared by Interface12 itself.
+	Extra()
+}
+
+// Local is a dummy type declared in package nested.
+type Local struct{}
+
+// Interface24 is a dummy interface to test the program output. This
+// interface tests qualification of types from its own package and from
+// another package, depending on the package the stubs are written in.
+type Interface24 interface {
+	// Convert is the method of Interface24.
+	Convert(in testdata.Struct5, out *Local) ([]testdata.Struct5, error)
+}
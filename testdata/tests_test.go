@@ -0,0 +1,8 @@
+package testdata
+
+// TestInterface is a dummy interface declared in a test file, which
+// impl only finds with -tests.
+type TestInterface interface {
+	// Method1 is the first method of TestInterface.
+	Method1(arg Struct5) error
+}
@@ -0,0 +1,21 @@
+package testdata_test
+
+import "github.com/josharian/impl/testdata"
+
+// XTestStruct is a dummy struct declared in an external test file.
+type XTestStruct struct{}
+
+// XTestInterface is a dummy interface declared in an external test
+// file, which impl only finds with -tests.
+type XTestInterface interface {
+	// Method1 is the first method of XTestInterface.
+	Method1(arg testdata.Struct5) XTestStruct
+}
+
+// Implemented collides with testdata.Implemented. Its methods must not
+// count as implemented for receivers in package testdata.
+type Implemented struct{}
+
+func (r *Implemented) Method2(_ int, arg2 int) (_ int, err error) {
+	return 0, nil
+}
@@ -0,0 +1,15 @@
+// Package yaml is declared in a directory whose name, yaml.v2, differs
+// from the package name, like gopkg.in/yaml.v2. It is used to test that
+// types from such packages are qualified with the package name.
+package yaml
+
+// Node is a dummy type declared in package yaml.
+type Node struct{}
+
+// Unmarshaler is a dummy interface to test the program output.
+type Unmarshaler interface {
+	// UnmarshalYAML is the first method of Unmarshaler.
+	UnmarshalYAML(unmarshal func(interface{}) error) error
+	// Decode is the second method of Unmarshaler.
+	Decode(n *Node) error
+}